@@ -0,0 +1,193 @@
+package webpush
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/url"
+	"sync"
+)
+
+const (
+	defaultBroadcastWorkers = 32
+	defaultPerHostLimit     = 16
+
+	// broadcastLookahead is the number of subscriptions Send reads ahead of
+	// the workers, so a host at its limit doesn't hold up sends to others.
+	broadcastLookahead = 4096
+)
+
+// Broadcaster sends the same notification to many subscriptions concurrently
+// using a bounded pool of workers. It is immutable once created and safe for
+// concurrent use.
+type Broadcaster struct {
+	client  *Client
+	workers int
+	perHost int
+}
+
+// BroadcastOption configures a Broadcaster created by NewBroadcaster.
+type BroadcastOption func(*Broadcaster) error
+
+// WithWorkers sets the number of concurrent sends. It must be positive. The
+// default is 32.
+func WithWorkers(n int) BroadcastOption {
+	return func(b *Broadcaster) error {
+		if n <= 0 {
+			return fmt.Errorf("broadcast workers must be positive, got %d", n)
+		}
+		b.workers = n
+		return nil
+	}
+}
+
+// WithPerHostLimit sets the maximum number of concurrent sends to a single
+// push service host. Zero means no limit beyond the number of workers. The
+// default is 16.
+func WithPerHostLimit(n int) BroadcastOption {
+	return func(b *Broadcaster) error {
+		if n < 0 {
+			return fmt.Errorf("per-host limit must not be negative, got %d", n)
+		}
+		b.perHost = n
+		return nil
+	}
+}
+
+// BroadcastResult is the outcome of sending to a single subscription.
+type BroadcastResult struct {
+	Subscription *Subscription
+	Result       *SendResult // Set if the send succeeded
+	Err          error       // Set if the send failed
+}
+
+// NewBroadcaster creates a Broadcaster that sends using the given client.
+func NewBroadcaster(client *Client, opts ...BroadcastOption) (*Broadcaster, error) {
+	b := &Broadcaster{
+		client:  client,
+		workers: defaultBroadcastWorkers,
+		perHost: defaultPerHostLimit,
+	}
+	for _, opt := range opts {
+		if err := opt(b); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Send sends payload to every subscription yielded by subs and returns a
+// channel of per-subscription results. The channel is closed once every
+// subscription has been attempted, or after ctx is canceled and in-flight
+// sends finish. Callers must drain the channel.
+//
+// Subscriptions are sent in order, except that those for a host already at
+// the per-host limit wait while later subscriptions for other hosts go ahead.
+func (b *Broadcaster) Send(ctx context.Context, subs iter.Seq[*Subscription], payload []byte, opts *Options) <-chan BroadcastResult {
+	results := make(chan BroadcastResult, b.workers)
+	go b.run(ctx, subs, payload, opts, results)
+	return results
+}
+
+// run schedules subscriptions onto the workers, holding back those whose
+// host is at the per-host limit, and closes results when done.
+func (b *Broadcaster) run(ctx context.Context, subs iter.Seq[*Subscription], payload []byte, opts *Options, results chan<- BroadcastResult) {
+	defer close(results)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	feed := make(chan *Subscription)
+	go func() {
+		defer close(feed)
+		for sub := range subs {
+			select {
+			case feed <- sub:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	jobs := make(chan *Subscription)
+	done := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(b.workers)
+	for range b.workers {
+		go func() {
+			defer wg.Done()
+			for sub := range jobs {
+				result, err := b.client.SendWithResult(ctx, sub, payload, opts)
+				results <- BroadcastResult{Subscription: sub, Result: result, Err: err}
+				done <- endpointHost(sub.Endpoint)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	var (
+		ready    []*Subscription                // Subscriptions whose host has a free slot
+		waiting  = map[string][]*Subscription{} // Subscriptions whose host is at the limit
+		slots    = map[string]int{}             // Ready or in-flight sends by host
+		buffered int                            // len(ready) plus all waiting
+		running  int                            // Sends in flight
+	)
+	var incoming <-chan *Subscription = feed // Nil once subs is exhausted or ctx is canceled
+	canceled := ctx.Done()
+	for incoming != nil || buffered > 0 || running > 0 {
+		var next *Subscription
+		var send chan<- *Subscription
+		if len(ready) > 0 {
+			next, send = ready[0], jobs
+		}
+		recv := incoming
+		if buffered >= broadcastLookahead {
+			recv = nil
+		}
+
+		select {
+		case sub, ok := <-recv:
+			if !ok {
+				incoming = nil
+				continue
+			}
+			buffered++
+			if host := endpointHost(sub.Endpoint); b.perHost == 0 || slots[host] < b.perHost {
+				slots[host]++
+				ready = append(ready, sub)
+			} else {
+				waiting[host] = append(waiting[host], sub)
+			}
+
+		case send <- next:
+			ready = ready[1:]
+			buffered--
+			running++
+
+		case host := <-done:
+			running--
+			slots[host]--
+			if queue := waiting[host]; len(queue) > 0 {
+				slots[host]++
+				ready = append(ready, queue[0])
+				if waiting[host] = queue[1:]; len(waiting[host]) == 0 {
+					delete(waiting, host)
+				}
+			}
+
+		case <-canceled:
+			// Stop reading and drop unsent subscriptions, but wait for
+			// in-flight sends to report their results.
+			canceled, incoming = nil, nil
+			ready, waiting, buffered = nil, nil, 0
+		}
+	}
+}
+
+// endpointHost returns the host an endpoint is sent to, for per-host limits.
+func endpointHost(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil {
+		return u.Host
+	}
+	return endpoint
+}
@@ -0,0 +1,198 @@
+package webpush
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrencyServer is a push service that tracks its peak concurrency.
+type concurrencyServer struct {
+	*httptest.Server
+	current, peak atomic.Int32
+}
+
+func newConcurrencyServer(t *testing.T) *concurrencyServer {
+	t.Helper()
+	s := &concurrencyServer{}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.current.Add(1)
+		defer s.current.Add(-1)
+		for {
+			peak := s.peak.Load()
+			if n <= peak || s.peak.CompareAndSwap(peak, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		if strings.HasSuffix(r.URL.Path, "/gone") {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestBroadcaster_Send(t *testing.T) {
+	serverA := newConcurrencyServer(t)
+	serverB := newConcurrencyServer(t)
+
+	p256dhBytes, _ := base64.RawURLEncoding.DecodeString("BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM")
+	keys := Keys{
+		P256dh: base64.RawURLEncoding.EncodeToString(p256dhBytes),
+		Auth:   base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+	}
+
+	var subs []*Subscription
+	for i := range 40 {
+		server := serverA
+		if i%2 == 1 {
+			server = serverB
+		}
+		subs = append(subs, &Subscription{Endpoint: fmt.Sprintf("%s/push/%d", server.URL, i), Keys: keys})
+	}
+	subs = append(subs, &Subscription{Endpoint: serverA.URL + "/push/gone", Keys: keys})
+
+	// httptest servers share a certificate, so one client trusts both
+	client, err := NewClient(&mockSigner{pubKey: p256dhBytes}, "mailto:test@example.com", WithHTTPClient(serverA.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	b, err := NewBroadcaster(client, WithWorkers(8), WithPerHostLimit(3))
+	if err != nil {
+		t.Fatalf("NewBroadcaster() error = %v", err)
+	}
+
+	var succeeded, gone int
+	seen := make(map[string]bool)
+	for res := range b.Send(context.Background(), slices.Values(subs), []byte("hello"), nil) {
+		seen[res.Subscription.Endpoint] = true
+		switch {
+		case res.Err == nil:
+			succeeded++
+		case IsGone(res.Err):
+			gone++
+		default:
+			t.Errorf("unexpected error for %s: %v", res.Subscription.Endpoint, res.Err)
+		}
+	}
+
+	if len(seen) != len(subs) {
+		t.Errorf("got results for %d subscriptions, want %d", len(seen), len(subs))
+	}
+	if succeeded != 40 || gone != 1 {
+		t.Errorf("succeeded = %d, gone = %d, want 40 and 1", succeeded, gone)
+	}
+	for name, s := range map[string]*concurrencyServer{"A": serverA, "B": serverB} {
+		if peak := s.peak.Load(); peak > 3 {
+			t.Errorf("server %s peak concurrency = %d, want <= 3", name, peak)
+		}
+	}
+}
+
+func TestBroadcaster_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// An endless iterator must not block Send once the context is canceled.
+	subs := func(yield func(*Subscription) bool) {
+		for yield(&Subscription{Endpoint: "https://push.example.com/x"}) {
+		}
+	}
+
+	client, err := NewClient(&mockSigner{}, "mailto:test@example.com")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	b, err := NewBroadcaster(client, WithWorkers(2))
+	if err != nil {
+		t.Fatalf("NewBroadcaster() error = %v", err)
+	}
+	for res := range b.Send(ctx, subs, []byte("hello"), nil) {
+		if res.Err == nil {
+			t.Error("expected error for canceled broadcast")
+		}
+	}
+}
+
+func TestBroadcaster_HostAtLimitDoesNotBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer slow.Close()
+	fast := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer fast.Close()
+
+	p256dhBytes, _ := base64.RawURLEncoding.DecodeString("BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM")
+	keys := Keys{
+		P256dh: base64.RawURLEncoding.EncodeToString(p256dhBytes),
+		Auth:   base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+	}
+
+	// A run of subscriptions for the slow host comes first
+	var subs []*Subscription
+	for i := range 10 {
+		subs = append(subs, &Subscription{Endpoint: fmt.Sprintf("%s/push/%d", slow.URL, i), Keys: keys})
+	}
+	subs = append(subs, &Subscription{Endpoint: fast.URL + "/push/fast", Keys: keys})
+
+	client, err := NewClient(&mockSigner{pubKey: p256dhBytes}, "mailto:test@example.com", WithHTTPClient(slow.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	b, err := NewBroadcaster(client, WithWorkers(4), WithPerHostLimit(1))
+	if err != nil {
+		t.Fatalf("NewBroadcaster() error = %v", err)
+	}
+
+	results := b.Send(context.Background(), slices.Values(subs), []byte("hello"), nil)
+	select {
+	case res := <-results:
+		if res.Subscription.Endpoint != fast.URL+"/push/fast" || res.Err != nil {
+			t.Errorf("first result = %s, %v; want the fast host's send to succeed", res.Subscription.Endpoint, res.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("send to the fast host waited for the slow host")
+	}
+
+	close(release)
+	n := 1
+	for res := range results {
+		if res.Err != nil {
+			t.Errorf("unexpected error for %s: %v", res.Subscription.Endpoint, res.Err)
+		}
+		n++
+	}
+	if n != len(subs) {
+		t.Errorf("got %d results, want %d", n, len(subs))
+	}
+}
+
+func TestNewBroadcaster_InvalidOptions(t *testing.T) {
+	client, err := NewClient(&mockSigner{}, "mailto:test@example.com")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	for name, opt := range map[string]BroadcastOption{
+		"zero workers":        WithWorkers(0),
+		"negative host limit": WithPerHostLimit(-1),
+	} {
+		if _, err := NewBroadcaster(client, opt); err == nil {
+			t.Errorf("NewBroadcaster() with %s: error = nil, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"fmt"
+
+	"github.com/imjasonh/webpush/ece"
+)
+
+// Decrypt decrypts an RFC 8291 aes128gcm push message body using the
+// subscriber's private key and authentication secret, returning the
+// plaintext with padding removed.
+//
+// This is the receiver side of Client.Send: it is what a browser does with a
+// push message, and is useful for testing and for building push receivers.
+func Decrypt(privateKey *ecdh.PrivateKey, authSecret, body []byte) ([]byte, error) {
+	return ece.Decrypt(body, func(keyID []byte) ([]byte, error) {
+		// For push messages, the key ID is the sender's ephemeral public key
+		serverPubKey, err := ecdh.P256().NewPublicKey(keyID)
+		if err != nil {
+			return nil, fmt.Errorf("parsing sender public key: %w", err)
+		}
+
+		sharedSecret, err := privateKey.ECDH(serverPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("computing shared secret: %w", err)
+		}
+
+		ikmInfo := append([]byte("WebPush: info\x00"), privateKey.PublicKey().Bytes()...)
+		ikmInfo = append(ikmInfo, keyID...)
+		ikm, err := deriveKey(sharedSecret, authSecret, ikmInfo, 32)
+		if err != nil {
+			return nil, fmt.Errorf("deriving IKM: %w", err)
+		}
+		return ikm, nil
+	})
+}
@@ -0,0 +1,103 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+)
+
+// encryptRecords builds an aes128gcm message for sub split into the given
+// record plaintexts, each of which must already include its padding.
+func encryptRecords(t *testing.T, sub *Subscription, rs uint32, records ...[]byte) []byte {
+	t.Helper()
+	clientPubBytes, _ := base64.RawURLEncoding.DecodeString(sub.Keys.P256dh)
+	auth, _ := base64.RawURLEncoding.DecodeString(sub.Keys.Auth)
+	clientPub, err := ecdh.P256().NewPublicKey(clientPubBytes)
+	if err != nil {
+		t.Fatalf("parsing p256dh: %v", err)
+	}
+
+	serverPriv, _ := ecdh.P256().GenerateKey(rand.Reader)
+	secret, _ := serverPriv.ECDH(clientPub)
+	salt := make([]byte, 16)
+	rand.Read(salt)
+
+	info := append([]byte("WebPush: info\x00"), clientPubBytes...)
+	info = append(info, serverPriv.PublicKey().Bytes()...)
+	prk, _ := deriveKey(secret, auth, info, 32)
+	cek, _ := deriveKey(prk, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce, _ := deriveKey(prk, salt, []byte("Content-Encoding: nonce\x00"), 12)
+
+	body := append([]byte{}, salt...)
+	body = binary.BigEndian.AppendUint32(body, rs)
+	body = append(body, 65)
+	body = append(body, serverPriv.PublicKey().Bytes()...)
+	for i, record := range records {
+		// The record nonce is the base nonce XORed with the sequence number
+		recordNonce := bytes.Clone(nonce)
+		recordNonce[len(recordNonce)-1] ^= byte(i)
+		ciphertext, err := seal(cek, recordNonce, record)
+		if err != nil {
+			t.Fatalf("seal() error = %v", err)
+		}
+		body = append(body, ciphertext...)
+	}
+	return body
+}
+
+func TestDecrypt_MultipleRecords(t *testing.T) {
+	sub, priv, auth := newTestSubscriber(t, "https://push.example.com/abc")
+
+	// rs = 24: each full record holds 8 bytes of plaintext and padding.
+	body := encryptRecords(t, sub, 24,
+		[]byte("I am t\x01\x00"),
+		[]byte("he walr\x01"),
+		[]byte("us\x02\x00\x00"),
+	)
+
+	got, err := Decrypt(priv, auth, body)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if want := "I am the walrus"; string(got) != want {
+		t.Errorf("Decrypt() = %q, want %q", got, want)
+	}
+}
+
+func TestDecrypt_Errors(t *testing.T) {
+	sub, priv, auth := newTestSubscriber(t, "https://push.example.com/abc")
+	encrypted, err := Encrypt(sub, []byte("hello"), &EncryptOptions{})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	valid := encrypted.Body
+
+	tampered := bytes.Clone(valid)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		auth []byte
+		body []byte
+	}{
+		{"empty", auth, nil},
+		{"truncated header", auth, valid[:20]},
+		{"no records", auth, valid[:86]},
+		{"tampered", auth, tampered},
+		{"wrong auth secret", make([]byte, 16), valid},
+		{"missing final delimiter", auth, encryptRecords(t, sub, 4096, []byte("hello\x01"))},
+		{"truncated records", auth, encryptRecords(t, sub, 24, []byte("I am t\x01\x00"))},
+		{"bad key ID", auth, append(append(bytes.Clone(valid[:20]), 1, 0x04), valid[86:]...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt(priv, tt.auth, tt.body); err == nil {
+				t.Error("Decrypt() expected error, got nil")
+			}
+		})
+	}
+}
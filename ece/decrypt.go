@@ -0,0 +1,139 @@
+package ece
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeyFunc returns the input keying material identified by the key ID in a
+// message header.
+type KeyFunc func(keyID []byte) ([]byte, error)
+
+// Decrypter is an io.Reader that decrypts an encrypted message read from an
+// underlying reader, returning the content with padding removed.
+//
+// Decrypted content is returned one record at a time, after the record has
+// been authenticated. A message that is truncated after a complete record is
+// detected, and reported as an error once the earlier records are read.
+type Decrypter struct {
+	r       io.Reader
+	key     KeyFunc
+	header  *Header
+	cipher  *recordCipher
+	initErr error
+
+	pending bytes.Buffer // Ciphertext read but not yet opened
+	eof     bool         // The underlying reader is exhausted
+	seq     uint64
+	out     []byte // Decrypted content not yet returned
+	err     error  // Returned once out is drained
+}
+
+// NewDecrypter returns a Decrypter that decrypts the message read from r,
+// using key to look up the keying material named in its header.
+func NewDecrypter(r io.Reader, key KeyFunc) *Decrypter {
+	return &Decrypter{r: r, key: key}
+}
+
+// Header returns the message header, reading it if necessary.
+func (d *Decrypter) Header() (*Header, error) {
+	if err := d.init(); err != nil {
+		return nil, err
+	}
+	return d.header, nil
+}
+
+// init reads the header and derives the record cipher, once.
+func (d *Decrypter) init() error {
+	if d.cipher == nil && d.initErr == nil {
+		d.header, d.cipher, d.initErr = d.readHeader()
+	}
+	return d.initErr
+}
+
+// readHeader reads the header and derives the record cipher from the keying
+// material it names.
+func (d *Decrypter) readHeader() (*Header, *recordCipher, error) {
+	h, err := ReadHeader(d.r)
+	if err != nil {
+		return nil, nil, err
+	}
+	ikm, err := d.key(h.KeyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	c, err := newRecordCipher(ikm, h.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, c, nil
+}
+
+// Read implements io.Reader.
+func (d *Decrypter) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.openRecord()
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// openRecord decrypts the next record into d.out. It returns io.EOF after
+// the last record.
+func (d *Decrypter) openRecord() error {
+	if err := d.init(); err != nil {
+		return err
+	}
+	rs := d.header.RecordSize
+
+	// Read one byte more than a record, to know whether this is the last.
+	// The buffer grows with the data read, so a large record size in the
+	// header doesn't by itself cause a large allocation.
+	if !d.eof {
+		want := int64(rs + 1 - d.pending.Len())
+		if _, err := io.CopyN(&d.pending, d.r, want); err == io.EOF {
+			d.eof = true
+		} else if err != nil {
+			return fmt.Errorf("reading record %d: %w", d.seq, err)
+		}
+	}
+	if d.pending.Len() == 0 {
+		if d.seq == 0 {
+			return errors.New("message has no records")
+		}
+		return fmt.Errorf("record %d: %w", d.seq, io.ErrUnexpectedEOF)
+	}
+
+	ciphertext := d.pending.Next(min(d.pending.Len(), rs))
+	last := d.eof && d.pending.Len() == 0
+
+	record, err := d.cipher.aead.Open(nil, d.cipher.recordNonce(d.seq), ciphertext, nil)
+	if err != nil {
+		return fmt.Errorf("decrypting record %d: %w", d.seq, err)
+	}
+	data, err := unpad(record, last)
+	if err != nil {
+		return fmt.Errorf("record %d: %w", d.seq, err)
+	}
+	d.out = data
+	d.seq++
+	if last {
+		return io.EOF
+	}
+	return nil
+}
+
+// Decrypt decrypts an encrypted message, returning its content.
+func Decrypt(message []byte, key KeyFunc) ([]byte, error) {
+	content, err := io.ReadAll(NewDecrypter(bytes.NewReader(message), key))
+	if err != nil {
+		return nil, err
+	}
+	return content, nil
+}
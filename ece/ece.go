@@ -0,0 +1,176 @@
+// Package ece implements the aes128gcm Encrypted Content-Encoding for HTTP
+// defined in RFC 8188.
+//
+// Content is split into records of a fixed size, each sealed with
+// AEAD_AES_128_GCM under a key and nonce derived from input keying material
+// and a random salt. Encrypter and Decrypter work on streams, so content of
+// any length can be encrypted without holding it all in memory.
+//
+// Web Push (RFC 8291) uses this coding with a single record; the webpush
+// package derives the keying material and uses this package for framing.
+package ece
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// SaltSize is the size of the salt in bytes.
+	SaltSize = 16
+
+	// TagSize is the size of the authentication tag added to each record.
+	TagSize = 16
+
+	// MinRecordSize is the smallest valid record size: a tag, a padding
+	// delimiter and one byte of content.
+	MinRecordSize = TagSize + 2
+
+	// DefaultRecordSize is the record size used when none is given.
+	DefaultRecordSize = 4096
+
+	// MaxKeyIDSize is the longest key ID the header can hold.
+	MaxKeyIDSize = 255
+
+	// headerSize is the size of the header without the key ID:
+	// salt (16) || rs (4) || idlen (1).
+	headerSize = SaltSize + 4 + 1
+)
+
+// Header is the header that precedes the records of an encrypted message.
+type Header struct {
+	Salt       []byte // SaltSize random bytes
+	RecordSize int    // Size of each record, including its tag
+	KeyID      []byte // Identifies the keying material; may be empty
+}
+
+// validate checks that the header can be encoded and used.
+func (h *Header) validate() error {
+	if len(h.Salt) != SaltSize {
+		return fmt.Errorf("salt must be %d bytes, got %d", SaltSize, len(h.Salt))
+	}
+	if h.RecordSize < MinRecordSize || int64(h.RecordSize) > 1<<32-1 {
+		return fmt.Errorf("invalid record size %d", h.RecordSize)
+	}
+	if len(h.KeyID) > MaxKeyIDSize {
+		return fmt.Errorf("key ID must be at most %d bytes, got %d", MaxKeyIDSize, len(h.KeyID))
+	}
+	return nil
+}
+
+// AppendBinary appends the encoded header to b.
+func (h *Header) AppendBinary(b []byte) ([]byte, error) {
+	if err := h.validate(); err != nil {
+		return nil, err
+	}
+	b = append(b, h.Salt...)
+	b = binary.BigEndian.AppendUint32(b, uint32(h.RecordSize))
+	b = append(b, byte(len(h.KeyID)))
+	return append(b, h.KeyID...), nil
+}
+
+// ReadHeader reads an encoded header from r.
+func ReadHeader(r io.Reader) (*Header, error) {
+	fixed := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("reading header: %w", noEOF(err))
+	}
+	h := &Header{
+		Salt:       fixed[:SaltSize],
+		RecordSize: int(binary.BigEndian.Uint32(fixed[SaltSize:])),
+		KeyID:      make([]byte, fixed[SaltSize+4]),
+	}
+	if _, err := io.ReadFull(r, h.KeyID); err != nil {
+		return nil, fmt.Errorf("reading key ID: %w", noEOF(err))
+	}
+	if h.RecordSize < MinRecordSize {
+		return nil, fmt.Errorf("invalid record size %d", h.RecordSize)
+	}
+	return h, nil
+}
+
+// noEOF converts io.EOF to io.ErrUnexpectedEOF, for reads that must succeed.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// recordCipher seals and opens records for one message.
+type recordCipher struct {
+	aead  cipher.AEAD
+	nonce []byte // Base nonce, XORed with the sequence number
+}
+
+// newRecordCipher derives the content encryption key and base nonce from the
+// input keying material and salt (RFC 8188 section 2.2 and 2.3).
+func newRecordCipher(ikm, salt []byte) (*recordCipher, error) {
+	if len(ikm) == 0 {
+		return nil, errors.New("key is required")
+	}
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, fmt.Errorf("deriving CEK: %w", err)
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, fmt.Errorf("deriving nonce: %w", err)
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM: %w", err)
+	}
+	return &recordCipher{aead: aead, nonce: nonce}, nil
+}
+
+// recordNonce returns the nonce for record seq: the base nonce XORed with the
+// big-endian sequence number (RFC 8188 section 2.3).
+func (c *recordCipher) recordNonce(seq uint64) []byte {
+	nonce := bytes.Clone(c.nonce)
+	for i := range 8 {
+		nonce[len(nonce)-1-i] ^= byte(seq >> (8 * i))
+	}
+	return nonce
+}
+
+// Padding delimiters, which end the data in each record (RFC 8188 section 2).
+const (
+	delimiter     = 0x01 // Ends every record but the last
+	lastDelimiter = 0x02 // Ends the last record
+)
+
+// unpad removes padding from a decrypted record. Records end with a
+// delimiter, followed by any number of zero bytes.
+func unpad(record []byte, last bool) ([]byte, error) {
+	i := len(record) - 1
+	for i >= 0 && record[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return nil, errors.New("missing padding delimiter")
+	}
+	switch {
+	case last && record[i] == lastDelimiter, !last && record[i] == delimiter:
+		return record[:i], nil
+	case last && record[i] == delimiter:
+		return nil, errors.New("message truncated after record")
+	case record[i] == lastDelimiter:
+		return nil, errors.New("unexpected data after last record")
+	default:
+		return nil, errors.New("missing padding delimiter")
+	}
+}
@@ -0,0 +1,240 @@
+package ece
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func decode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", s, err)
+	}
+	return b
+}
+
+func staticKey(ikm []byte) KeyFunc {
+	return func([]byte) ([]byte, error) { return ikm, nil }
+}
+
+// Examples from RFC 8188 section 3.
+func TestRFC8188Examples(t *testing.T) {
+	t.Run("3.1 single record", func(t *testing.T) {
+		ikm := decode(t, "yqdlZ-tYemfogSmv7Ws5PQ")
+		want := decode(t, "I1BsxtFttlv3u_Oo94xnmwAAEAAA-NAVub2qFgBEuQKRapoZu-IxkIva3MEB1PD-ly8Thjg")
+
+		got, err := Encrypt([]byte("I am the walrus"), Params{
+			Key:  ikm,
+			Salt: decode(t, "I1BsxtFttlv3u_Oo94xnmw"),
+		})
+		if err != nil {
+			t.Fatalf("Encrypt() error = %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Encrypt() = %x, want %x", got, want)
+		}
+
+		content, err := Decrypt(want, staticKey(ikm))
+		if err != nil {
+			t.Fatalf("Decrypt() error = %v", err)
+		}
+		if string(content) != "I am the walrus" {
+			t.Errorf("Decrypt() = %q, want %q", content, "I am the walrus")
+		}
+	})
+
+	t.Run("3.2 multiple records", func(t *testing.T) {
+		message := decode(t, "uNCkWiNYzKTnBN9ji3-qWAAAABkCYTHOG8chz_gnvgOqdGYovxyjuqRyJFjEDyoF1Fvkj6hQPdPHI51OEUKEpgz3SsLWIqS_uA")
+		var keyID []byte
+		content, err := Decrypt(message, func(id []byte) ([]byte, error) {
+			keyID = id
+			return decode(t, "BO3ZVPxUlnLORbVGMpbT1Q"), nil
+		})
+		if err != nil {
+			t.Fatalf("Decrypt() error = %v", err)
+		}
+		if string(keyID) != "a1" {
+			t.Errorf("key ID = %q, want %q", keyID, "a1")
+		}
+		if string(content) != "I am the walrus" {
+			t.Errorf("Decrypt() = %q, want %q", content, "I am the walrus")
+		}
+	})
+}
+
+func TestRoundTrip(t *testing.T) {
+	ikm := make([]byte, 16)
+	rand.Read(ikm)
+	content := make([]byte, 1000)
+	rand.Read(content)
+
+	for _, rs := range []int{MinRecordSize, 25, 100, 1017, 4096} {
+		for _, size := range []int{0, 1, 100, 1000} {
+			for _, padding := range []int{0, 1, 50, 2000} {
+				t.Run(fmt.Sprintf("rs=%d/size=%d/padding=%d", rs, size, padding), func(t *testing.T) {
+					message, err := Encrypt(content[:size], Params{Key: ikm, RecordSize: rs, KeyID: []byte("k1"), Padding: padding})
+					if err != nil {
+						t.Fatalf("Encrypt() error = %v", err)
+					}
+
+					// Every record but the last is exactly rs bytes
+					capacity := rs - TagSize - 1
+					records := max(1, (size+padding+capacity-1)/capacity)
+					if want := headerSize + 2 + (records-1)*rs; len(message) <= want || len(message) > want+rs {
+						t.Errorf("len(message) = %d, want %d records of size %d", len(message), records, rs)
+					}
+
+					got, err := Decrypt(message, staticKey(ikm))
+					if err != nil {
+						t.Fatalf("Decrypt() error = %v", err)
+					}
+					if !bytes.Equal(got, content[:size]) {
+						t.Errorf("Decrypt() = %x, want %x", got, content[:size])
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	ikm := make([]byte, 16)
+	rand.Read(ikm)
+	content := make([]byte, 10000)
+	rand.Read(content)
+
+	// Read one byte at a time in both directions
+	e, err := NewEncrypter(iotest.OneByteReader(bytes.NewReader(content)), Params{Key: ikm, RecordSize: 1024})
+	if err != nil {
+		t.Fatalf("NewEncrypter() error = %v", err)
+	}
+	d := NewDecrypter(iotest.OneByteReader(e), staticKey(ikm))
+	got, err := io.ReadAll(iotest.OneByteReader(d))
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("decrypted content does not match")
+	}
+
+	h, err := d.Header()
+	if err != nil {
+		t.Fatalf("Header() error = %v", err)
+	}
+	if h.RecordSize != 1024 {
+		t.Errorf("RecordSize = %d, want 1024", h.RecordSize)
+	}
+}
+
+func TestStreaming_ReadError(t *testing.T) {
+	e, err := NewEncrypter(iotest.ErrReader(errors.New("disk on fire")), Params{Key: []byte("key")})
+	if err != nil {
+		t.Fatalf("NewEncrypter() error = %v", err)
+	}
+	if _, err := io.ReadAll(e); err == nil {
+		t.Error("ReadAll() expected error, got nil")
+	}
+}
+
+func TestNewEncrypter_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Params
+	}{
+		{"no key", Params{}},
+		{"short salt", Params{Key: []byte("key"), Salt: make([]byte, 8)}},
+		{"record size too small", Params{Key: []byte("key"), RecordSize: MinRecordSize - 1}},
+		{"key ID too long", Params{Key: []byte("key"), KeyID: make([]byte, 256)}},
+		{"negative padding", Params{Key: []byte("key"), Padding: -1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEncrypter(bytes.NewReader(nil), tt.p); err == nil {
+				t.Error("NewEncrypter() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestDecrypt_Errors(t *testing.T) {
+	ikm := []byte("0123456789abcdef")
+	message, err := Encrypt([]byte("I am the walrus"), Params{Key: ikm, RecordSize: 24})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	const firstRecord = headerSize // No key ID
+	records := message[firstRecord:]
+
+	tampered := bytes.Clone(message)
+	tampered[len(tampered)-1] ^= 0xff
+
+	// Swap the first two records
+	reordered := append(bytes.Clone(message[:firstRecord]), records[24:48]...)
+	reordered = append(reordered, records[:24]...)
+	reordered = append(reordered, records[48:]...)
+
+	tests := []struct {
+		name    string
+		message []byte
+		key     KeyFunc
+	}{
+		{"empty", nil, staticKey(ikm)},
+		{"truncated header", message[:10], staticKey(ikm)},
+		{"no records", message[:firstRecord], staticKey(ikm)},
+		{"truncated after record", message[:firstRecord+24], staticKey(ikm)},
+		{"truncated mid record", message[:len(message)-1], staticKey(ikm)},
+		{"tampered", tampered, staticKey(ikm)},
+		{"reordered", reordered, staticKey(ikm)},
+		{"wrong key", message, staticKey([]byte("fedcba9876543210"))},
+		{"key lookup fails", message, func([]byte) ([]byte, error) { return nil, errors.New("unknown key") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decrypt(tt.message, tt.key); err == nil {
+				t.Error("Decrypt() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestUnpad(t *testing.T) {
+	tests := []struct {
+		name    string
+		record  string
+		last    bool
+		want    string
+		wantErr bool
+	}{
+		{"last", "data\x02", true, "data", false},
+		{"last with padding", "data\x02\x00\x00", true, "data", false},
+		{"not last", "data\x01\x00", false, "data", false},
+		{"padding only", "\x01\x00\x00", false, "", false},
+		{"zeros in data", "d\x00ta\x02\x00", true, "d\x00ta", false},
+		{"all zeros", "\x00\x00", true, "", true},
+		{"empty", "", true, "", true},
+		{"truncated", "data\x01", true, "", true},
+		{"early last", "data\x02", false, "", true},
+		{"bad delimiter", "data\x03", true, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unpad([]byte(tt.record), tt.last)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unpad() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("unpad() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package ece
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Params configures encryption.
+type Params struct {
+	Key        []byte // Input keying material
+	Salt       []byte // SaltSize bytes; random if nil
+	RecordSize int    // Record size including the tag (default DefaultRecordSize)
+	KeyID      []byte // Sent in the header to identify Key; may be empty
+	Padding    int    // Number of zero bytes of padding to add after the content
+}
+
+// Encrypter is an io.Reader that encrypts content read from an underlying
+// reader, returning the header followed by the encrypted records.
+type Encrypter struct {
+	r        io.Reader
+	cipher   *recordCipher
+	capacity int // Bytes of data and padding per record, excluding the delimiter
+
+	pending bytes.Buffer // Plaintext read but not yet sealed
+	eof     bool         // The underlying reader is exhausted
+	padding int          // Padding not yet added
+	seq     uint64
+	out     []byte // Encrypted output not yet returned
+	err     error  // Returned once out is drained
+}
+
+// NewEncrypter returns an Encrypter that encrypts the content of r.
+func NewEncrypter(r io.Reader, p Params) (*Encrypter, error) {
+	if p.Padding < 0 {
+		return nil, errors.New("padding must not be negative")
+	}
+	h := Header{Salt: p.Salt, RecordSize: p.RecordSize, KeyID: p.KeyID}
+	if h.Salt == nil {
+		h.Salt = make([]byte, SaltSize)
+		if _, err := rand.Read(h.Salt); err != nil {
+			return nil, fmt.Errorf("generating salt: %w", err)
+		}
+	}
+	if h.RecordSize == 0 {
+		h.RecordSize = DefaultRecordSize
+	}
+	header, err := h.AppendBinary(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newRecordCipher(p.Key, h.Salt)
+	if err != nil {
+		return nil, err
+	}
+	return &Encrypter{
+		r:        r,
+		cipher:   c,
+		capacity: h.RecordSize - TagSize - 1,
+		padding:  p.Padding,
+		out:      header,
+	}, nil
+}
+
+// Read implements io.Reader.
+func (e *Encrypter) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		e.err = e.sealRecord()
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// sealRecord encrypts the next record into e.out. It returns io.EOF after
+// the last record.
+func (e *Encrypter) sealRecord() error {
+	// Read one byte more than fits, to know whether this is the last record
+	if !e.eof {
+		want := int64(e.capacity + 1 - e.pending.Len())
+		if _, err := io.CopyN(&e.pending, e.r, want); err == io.EOF {
+			e.eof = true
+		} else if err != nil {
+			return fmt.Errorf("reading content: %w", err)
+		}
+	}
+
+	data := e.pending.Next(min(e.pending.Len(), e.capacity))
+	pad := min(e.padding, e.capacity-len(data))
+	e.padding -= pad
+	last := e.eof && e.pending.Len() == 0 && e.padding == 0
+
+	record := make([]byte, 0, len(data)+1+pad+TagSize)
+	record = append(record, data...)
+	if last {
+		record = append(record, lastDelimiter)
+	} else {
+		record = append(record, delimiter)
+	}
+	record = append(record, make([]byte, pad)...)
+
+	e.out = e.cipher.aead.Seal(record[:0], e.cipher.recordNonce(e.seq), record, nil)
+	e.seq++
+	if last {
+		return io.EOF
+	}
+	return nil
+}
+
+// Encrypt encrypts content, returning the header followed by the records.
+func Encrypt(content []byte, p Params) ([]byte, error) {
+	e, err := NewEncrypter(bytes.NewReader(content), p)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(e)
+}
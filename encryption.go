@@ -0,0 +1,268 @@
+package webpush
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/imjasonh/webpush/ece"
+	"golang.org/x/crypto/hkdf"
+)
+
+// ContentEncoding identifies how a push message payload is encrypted.
+type ContentEncoding string
+
+const (
+	// AES128GCM is the RFC 8291 content encoding supported by all current
+	// browsers. It is the default.
+	AES128GCM ContentEncoding = "aes128gcm"
+
+	// AESGCM is the legacy encoding from draft-ietf-webpush-encryption-04,
+	// still required by some older browsers and push receivers. Its
+	// parameters are sent in the Encryption and Crypto-Key headers rather
+	// than in the payload.
+	AESGCM ContentEncoding = "aesgcm"
+)
+
+// EncryptedPayload is an encrypted push message body, along with the
+// parameters a push service needs to deliver it.
+type EncryptedPayload struct {
+	Body      []byte
+	Encoding  ContentEncoding
+	Salt      []byte // Sent in the Encryption header for aesgcm
+	PublicKey []byte // Ephemeral server public key, sent in Crypto-Key for aesgcm
+}
+
+// SetHeaders sets the request headers describing the encrypted payload.
+func (e *EncryptedPayload) SetHeaders(h http.Header) {
+	h.Set("Content-Encoding", string(e.Encoding))
+	if e.Encoding == AESGCM {
+		h.Set("Encryption", "salt="+base64.RawURLEncoding.EncodeToString(e.Salt))
+		h.Set("Crypto-Key", "dh="+base64.RawURLEncoding.EncodeToString(e.PublicKey))
+	}
+}
+
+// EncryptOptions configures Encrypt.
+type EncryptOptions struct {
+	ContentEncoding ContentEncoding // Default AES128GCM
+	Padding         Padding         // Default no padding
+
+	// Rand is the source of randomness for the ephemeral key, salt and
+	// padding. If nil, crypto/rand is used. A deterministic reader makes
+	// the output reproducible, which is only useful for tests.
+	Rand io.Reader
+
+	// Salt and PrivateKey, if set, are used instead of generating a salt and
+	// ephemeral key. They must never be reused for real messages.
+	Salt       []byte
+	PrivateKey *ecdh.PrivateKey
+}
+
+// Encrypt encrypts a push message payload for a subscription using RFC 8291
+// message encryption, or the legacy aesgcm scheme if requested. Send
+// encrypts payloads itself; Encrypt is for sending requests by other means
+// and for producing test vectors.
+func Encrypt(sub *Subscription, plaintext []byte, opts *EncryptOptions) (*EncryptedPayload, error) {
+	if opts == nil {
+		opts = &EncryptOptions{}
+	}
+	encoding := opts.ContentEncoding
+	if encoding == "" {
+		encoding = AES128GCM
+	}
+	if encoding != AES128GCM && encoding != AESGCM {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	if limit := maxPlaintext(encoding); len(plaintext) > limit {
+		return nil, &PayloadTooLargeError{
+			Size: MaxRecordSize - limit + len(plaintext),
+			Max:  MaxRecordSize,
+		}
+	}
+
+	random := opts.Rand
+	if random == nil {
+		random = rand.Reader
+	}
+
+	// Decode subscription keys
+	p256dhBytes, err := base64.RawURLEncoding.DecodeString(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("decoding p256dh: %w", err)
+	}
+
+	authBytes, err := base64.RawURLEncoding.DecodeString(sub.Keys.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("decoding auth: %w", err)
+	}
+
+	// Parse client's public key
+	clientPubKey, err := ecdh.P256().NewPublicKey(p256dhBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing client public key: %w", err)
+	}
+
+	// Generate ephemeral key pair for encryption
+	serverPrivKey := opts.PrivateKey
+	if serverPrivKey == nil {
+		if serverPrivKey, err = generateKey(opts.Rand); err != nil {
+			return nil, fmt.Errorf("generating server key: %w", err)
+		}
+	}
+	if serverPrivKey.Curve() != ecdh.P256() {
+		return nil, errors.New("server key must be a P-256 key")
+	}
+	serverPubKey := serverPrivKey.PublicKey()
+
+	// Perform ECDH to get shared secret
+	sharedSecret, err := serverPrivKey.ECDH(clientPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("computing shared secret: %w", err)
+	}
+
+	// Generate salt
+	salt := opts.Salt
+	if salt == nil {
+		salt = make([]byte, 16)
+		if _, err := io.ReadFull(random, salt); err != nil {
+			return nil, fmt.Errorf("generating salt: %w", err)
+		}
+	} else if len(salt) != 16 {
+		return nil, fmt.Errorf("salt must be 16 bytes, got %d", len(salt))
+	}
+
+	padLen, err := paddingLength(opts.Padding, len(plaintext), encoding, random)
+	if err != nil {
+		return nil, fmt.Errorf("computing padding: %w", err)
+	}
+
+	if encoding == AESGCM {
+		return encryptAESGCM(clientPubKey.Bytes(), serverPubKey.Bytes(), sharedSecret, authBytes, salt, plaintext, padLen)
+	}
+
+	// Derive keys using HKDF per RFC 8291
+	ikmInfo := append([]byte("WebPush: info\x00"), clientPubKey.Bytes()...)
+	ikmInfo = append(ikmInfo, serverPubKey.Bytes()...)
+
+	// IKM = HKDF(auth_secret, ecdh_secret, key_info)
+	ikm, err := deriveKey(sharedSecret, authBytes, ikmInfo, 32)
+	if err != nil {
+		return nil, fmt.Errorf("deriving IKM: %w", err)
+	}
+
+	// Push messages are a single record; with a 4096-byte record size, any
+	// payload that passed the size check fits in one. The key ID is the
+	// ephemeral public key.
+	ciphertext, err := ece.Encrypt(plaintext, ece.Params{
+		Key:        ikm,
+		Salt:       salt,
+		RecordSize: MaxRecordSize,
+		KeyID:      serverPubKey.Bytes(),
+		Padding:    padLen,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedPayload{
+		Body:     ciphertext,
+		Encoding: AES128GCM,
+	}, nil
+}
+
+// generateKey generates an ephemeral P-256 key. With a nil reader it uses
+// crypto/rand; otherwise the key is derived from the reader's output alone,
+// since ecdh.GenerateKey doesn't promise to be deterministic.
+func generateKey(r io.Reader) (*ecdh.PrivateKey, error) {
+	if r == nil {
+		return ecdh.P256().GenerateKey(rand.Reader)
+	}
+	b := make([]byte, 32)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		// Retry the rare scalars that are zero or not less than the order
+		if k, err := ecdh.P256().NewPrivateKey(b); err == nil {
+			return k, nil
+		}
+	}
+}
+
+// encryptAESGCM encrypts the payload using the legacy aesgcm scheme from
+// draft-ietf-webpush-encryption-04 and draft-ietf-httpbis-encryption-encoding-03.
+func encryptAESGCM(clientPubKey, serverPubKey, sharedSecret, authSecret, salt, plaintext []byte, padLen int) (*EncryptedPayload, error) {
+	// IKM = HKDF(auth_secret, ecdh_secret, "Content-Encoding: auth\0")
+	ikm, err := deriveKey(sharedSecret, authSecret, []byte("Content-Encoding: auth\x00"), 32)
+	if err != nil {
+		return nil, fmt.Errorf("deriving IKM: %w", err)
+	}
+
+	// context = "P-256" || 0x00 || len(ua_public) || ua_public || len(as_public) || as_public
+	context := []byte("P-256\x00")
+	context = binary.BigEndian.AppendUint16(context, uint16(len(clientPubKey)))
+	context = append(context, clientPubKey...)
+	context = binary.BigEndian.AppendUint16(context, uint16(len(serverPubKey)))
+	context = append(context, serverPubKey...)
+
+	cek, err := deriveKey(ikm, salt, append([]byte("Content-Encoding: aesgcm\x00"), context...), 16)
+	if err != nil {
+		return nil, fmt.Errorf("deriving CEK: %w", err)
+	}
+
+	nonce, err := deriveKey(ikm, salt, append([]byte("Content-Encoding: nonce\x00"), context...), 12)
+	if err != nil {
+		return nil, fmt.Errorf("deriving nonce: %w", err)
+	}
+
+	// Each record starts with a two-byte padding length, followed by the padding
+	padded := make([]byte, 0, 2+padLen+len(plaintext))
+	padded = binary.BigEndian.AppendUint16(padded, uint16(padLen))
+	padded = append(padded, make([]byte, padLen)...)
+	padded = append(padded, plaintext...)
+
+	ciphertext, err := seal(cek, nonce, padded)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedPayload{
+		Body:      ciphertext,
+		Encoding:  AESGCM,
+		Salt:      salt,
+		PublicKey: serverPubKey,
+	}, nil
+}
+
+// deriveKey derives length bytes using HKDF-SHA-256.
+func deriveKey(secret, salt, info []byte, length int) ([]byte, error) {
+	key := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// seal encrypts plaintext using AES-128-GCM.
+func seal(key, nonce, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("creating cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCM: %w", err)
+	}
+
+	return gcm.Seal(nil, nonce, plaintext, nil), nil
+}
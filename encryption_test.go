@@ -0,0 +1,296 @@
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imjasonh/webpush/ece"
+)
+
+// newTestSubscriber returns a subscription for the given endpoint along with
+// the private key and auth secret needed to decrypt messages sent to it.
+func newTestSubscriber(t *testing.T, endpoint string) (*Subscription, *ecdh.PrivateKey, []byte) {
+	t.Helper()
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	auth := make([]byte, 16)
+	rand.Read(auth)
+
+	return &Subscription{
+		Endpoint: endpoint,
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(priv.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(auth),
+		},
+	}, priv, auth
+}
+
+// open decrypts an AES-128-GCM ciphertext.
+func open(t *testing.T, key, nonce, ciphertext []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher() error = %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("NewGCM() error = %v", err)
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	return plaintext
+}
+
+// decryptAESGCM decrypts an aesgcm payload using the salt and server key from
+// its headers, returning the record plaintext including its padding length.
+func decryptAESGCM(t *testing.T, priv *ecdh.PrivateKey, auth []byte, header http.Header, body []byte) []byte {
+	t.Helper()
+	salt, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(header.Get("Encryption"), "salt="))
+	if err != nil {
+		t.Fatalf("decoding salt: %v", err)
+	}
+	var dh string
+	for _, param := range strings.Split(header.Get("Crypto-Key"), ";") {
+		if v, ok := strings.CutPrefix(param, "dh="); ok {
+			dh = v
+		}
+	}
+	serverPubBytes, err := base64.RawURLEncoding.DecodeString(dh)
+	if err != nil {
+		t.Fatalf("decoding dh: %v", err)
+	}
+	serverPub, err := ecdh.P256().NewPublicKey(serverPubBytes)
+	if err != nil {
+		t.Fatalf("parsing dh: %v", err)
+	}
+	secret, err := priv.ECDH(serverPub)
+	if err != nil {
+		t.Fatalf("ECDH() error = %v", err)
+	}
+
+	clientPub := priv.PublicKey().Bytes()
+	context := []byte("P-256\x00")
+	context = binary.BigEndian.AppendUint16(context, uint16(len(clientPub)))
+	context = append(context, clientPub...)
+	context = binary.BigEndian.AppendUint16(context, uint16(len(serverPubBytes)))
+	context = append(context, serverPubBytes...)
+
+	ikm, _ := deriveKey(secret, auth, []byte("Content-Encoding: auth\x00"), 32)
+	cek, _ := deriveKey(ikm, salt, append([]byte("Content-Encoding: aesgcm\x00"), context...), 16)
+	nonce, _ := deriveKey(ikm, salt, append([]byte("Content-Encoding: nonce\x00"), context...), 12)
+	return open(t, cek, nonce, body)
+}
+
+func TestEncrypt_AES128GCM(t *testing.T) {
+	sub, priv, auth := newTestSubscriber(t, "https://push.example.com/abc")
+
+	encrypted, err := Encrypt(sub, []byte("hello"), &EncryptOptions{})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if encrypted.Encoding != AES128GCM {
+		t.Errorf("encoding = %q, want %q", encrypted.Encoding, AES128GCM)
+	}
+
+	// A single record with the standard record size, keyed by the
+	// ephemeral public key (RFC 8291 section 4)
+	h, err := ece.ReadHeader(bytes.NewReader(encrypted.Body))
+	if err != nil {
+		t.Fatalf("ReadHeader() error = %v", err)
+	}
+	if h.RecordSize != 4096 {
+		t.Errorf("RecordSize = %d, want 4096", h.RecordSize)
+	}
+	if len(h.KeyID) != 65 {
+		t.Errorf("len(KeyID) = %d, want 65", len(h.KeyID))
+	}
+
+	got, err := Decrypt(priv, auth, encrypted.Body)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if want := []byte("hello"); !bytes.Equal(got, want) {
+		t.Errorf("plaintext = %q, want %q", got, want)
+	}
+}
+
+func TestEncrypt_AESGCM(t *testing.T) {
+	sub, priv, auth := newTestSubscriber(t, "https://push.example.com/abc")
+
+	encrypted, err := Encrypt(sub, []byte("hello"), &EncryptOptions{ContentEncoding: AESGCM})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	header := make(http.Header)
+	encrypted.SetHeaders(header)
+
+	got := decryptAESGCM(t, priv, auth, header, encrypted.Body)
+	if want := []byte("\x00\x00hello"); !bytes.Equal(got, want) {
+		t.Errorf("plaintext = %q, want %q", got, want)
+	}
+}
+
+// Example from RFC 8291 Appendix A.
+func TestEncrypt_RFC8291Example(t *testing.T) {
+	decode := func(s string) []byte {
+		t.Helper()
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", s, err)
+		}
+		return b
+	}
+	asPrivate, err := ecdh.P256().NewPrivateKey(decode("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	if err != nil {
+		t.Fatalf("NewPrivateKey() error = %v", err)
+	}
+	uaPrivate, err := ecdh.P256().NewPrivateKey(decode("q1dXpw3UpT5VOmu_cf_v6ih07Aems3njxI-JWgLcM94"))
+	if err != nil {
+		t.Fatalf("NewPrivateKey() error = %v", err)
+	}
+	sub := &Subscription{
+		Endpoint: "https://push.example.net/push/JzLQ3raZJfFBR0aqvOMsLrt54w4rJUsV",
+		Keys: Keys{
+			P256dh: "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4",
+			Auth:   "BTBZMqHH6r4Tts7J_aSIgg",
+		},
+	}
+	const plaintext = "When I grow up, I want to be a watermelon"
+	want := decode("DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN")
+
+	encrypted, err := Encrypt(sub, []byte(plaintext), &EncryptOptions{
+		Salt:       decode("DGv6ra1nlYgDCS1FRnbzlw"),
+		PrivateKey: asPrivate,
+	})
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !bytes.Equal(encrypted.Body, want) {
+		t.Errorf("Encrypt() = %s\nwant %s", base64.RawURLEncoding.EncodeToString(encrypted.Body), base64.RawURLEncoding.EncodeToString(want))
+	}
+
+	got, err := Decrypt(uaPrivate, decode(sub.Keys.Auth), want)
+	if err != nil {
+		t.Fatalf("Decrypt() error = %v", err)
+	}
+	if string(got) != plaintext {
+		t.Errorf("Decrypt() = %q, want %q", got, plaintext)
+	}
+}
+
+func TestEncrypt_Rand(t *testing.T) {
+	sub, priv, auth := newTestSubscriber(t, "https://push.example.com/abc")
+
+	for _, encoding := range []ContentEncoding{AES128GCM, AESGCM} {
+		t.Run(string(encoding), func(t *testing.T) {
+			// The same randomness produces the same message
+			seed := make([]byte, 1024)
+			rand.Read(seed)
+			var bodies [2][]byte
+			for i := range bodies {
+				encrypted, err := Encrypt(sub, []byte("hello"), &EncryptOptions{
+					ContentEncoding: encoding,
+					Padding:         PadRandom(100),
+					Rand:            bytes.NewReader(seed),
+				})
+				if err != nil {
+					t.Fatalf("Encrypt() error = %v", err)
+				}
+				bodies[i] = encrypted.Body
+				if encoding == AES128GCM {
+					if got, err := Decrypt(priv, auth, encrypted.Body); err != nil || string(got) != "hello" {
+						t.Errorf("Decrypt() = %q, %v, want %q", got, err, "hello")
+					}
+				}
+			}
+			if !bytes.Equal(bodies[0], bodies[1]) {
+				t.Error("Encrypt() with the same Rand produced different messages")
+			}
+
+			// Running out of randomness is an error
+			if _, err := Encrypt(sub, []byte("hello"), &EncryptOptions{ContentEncoding: encoding, Rand: bytes.NewReader(seed[:40])}); err == nil {
+				t.Error("Encrypt() expected error when randomness is exhausted")
+			}
+		})
+	}
+}
+
+func TestEncrypt_InvalidOptions(t *testing.T) {
+	sub, _, _ := newTestSubscriber(t, "https://push.example.com/abc")
+	x25519, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts *EncryptOptions
+	}{
+		{"short salt", &EncryptOptions{Salt: make([]byte, 8)}},
+		{"wrong curve", &EncryptOptions{PrivateKey: x25519}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Encrypt(sub, []byte("hello"), tt.opts); err == nil {
+				t.Error("Encrypt() expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestEncrypt_UnsupportedEncoding(t *testing.T) {
+	sub, _, _ := newTestSubscriber(t, "https://push.example.com/abc")
+	if _, err := Encrypt(sub, []byte("hello"), &EncryptOptions{ContentEncoding: "gzip"}); err == nil {
+		t.Error("Encrypt() expected error for unsupported encoding")
+	}
+}
+
+func TestClient_SendAESGCM(t *testing.T) {
+	type request struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body bytes.Buffer
+		body.ReadFrom(r.Body)
+		requests <- request{r.Header, body.Bytes()}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sub, priv, auth := newTestSubscriber(t, server.URL+"/push/abc")
+	client, err := NewClient(&mockSigner{pubKey: priv.PublicKey().Bytes()}, "mailto:test@example.com", WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.Send(context.Background(), sub, []byte("legacy"), &Options{ContentEncoding: AESGCM}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	req := <-requests
+	if got := req.header.Get("Content-Encoding"); got != "aesgcm" {
+		t.Errorf("Content-Encoding = %q, want %q", got, "aesgcm")
+	}
+	if !strings.HasPrefix(req.header.Get("Encryption"), "salt=") {
+		t.Errorf("Encryption = %q, want salt= parameter", req.header.Get("Encryption"))
+	}
+	if got := decryptAESGCM(t, priv, auth, req.header, req.body); !bytes.Equal(got, []byte("\x00\x00legacy")) {
+		t.Errorf("plaintext = %q, want %q", got, "\x00\x00legacy")
+	}
+}
@@ -0,0 +1,178 @@
+package webpush
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PushError is returned by Client.Send when the push service responds with a
+// non-2xx status code.
+type PushError struct {
+	StatusCode int           // HTTP status code returned by the push service
+	Header     http.Header   // Response headers
+	Body       []byte        // Response body, if any
+	Endpoint   string        // Subscription endpoint the message was sent to; empty for Client.Cancel
+	RetryAfter time.Duration // Parsed Retry-After header, or 0 if absent
+	Provider   Provider      // Push service the endpoint belongs to, if known
+	Code       string        // Provider-specific error code, such as a Mozilla errno, if any
+	Message    string        // Provider-specific error message, if any
+	Reason     Reason        // Why the message was rejected; see ReasonOf
+}
+
+// Error implements the error interface.
+func (e *PushError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = string(e.Body)
+	}
+	if e.Code != "" {
+		msg = strings.TrimSpace("[" + e.Code + "] " + msg)
+	}
+	if msg == "" {
+		return fmt.Sprintf("push service returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("push service returned %d: %s", e.StatusCode, msg)
+}
+
+// Is reports whether target is ErrMessageNotFound and the error is a
+// Client.Cancel of a message that no longer exists.
+func (e *PushError) Is(target error) bool {
+	return target == ErrMessageNotFound && e.Reason == ReasonMessageNotFound
+}
+
+// ErrMessageNotFound reports that Client.Cancel found no message to delete,
+// because it was already delivered or has expired. The subscription is
+// unaffected.
+var ErrMessageNotFound = errors.New("push message not found")
+
+// ErrPayloadTooLarge reports that a payload is too large to send. Errors
+// returned by Client.Send for oversize payloads are *PayloadTooLargeError
+// values, which match ErrPayloadTooLarge with errors.Is.
+var ErrPayloadTooLarge = errors.New("payload too large")
+
+// PayloadTooLargeError is returned by Client.Send, before any request is
+// made, when the encrypted payload would exceed the size push services are
+// required to accept.
+type PayloadTooLargeError struct {
+	Size int // Encrypted payload size in bytes, including header and tag
+	Max  int // Maximum encrypted payload size in bytes
+}
+
+// Error implements the error interface.
+func (e *PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("payload too large: encrypted size %d bytes exceeds maximum of %d", e.Size, e.Max)
+}
+
+// Is reports whether target is ErrPayloadTooLarge.
+func (e *PayloadTooLargeError) Is(target error) bool {
+	return target == ErrPayloadTooLarge
+}
+
+// ValidationError is returned by Client.Send, before any request is made,
+// when an option is invalid, and by ParseSubscription when a subscription
+// field is invalid.
+type ValidationError struct {
+	Field  string // Options field name, such as "Urgency", subscription JSON field, such as "keys.auth", or "subject"
+	Value  string // The invalid value
+	Reason string // Why the value is invalid
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// newPushError builds a PushError from a push service response, parsing the
+// body and reason according to the push service's profile.
+func newPushError(resp *http.Response, body []byte, endpoint string) *PushError {
+	pe := &PushError{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		Endpoint:   endpoint,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		Reason:     statusReason(resp.StatusCode),
+	}
+	if p := lookupProfile(endpoint); p != nil {
+		pe.Provider = p.Provider
+		if p.ParseError != nil {
+			pe.Code, pe.Message = p.ParseError(resp.Header, body)
+		}
+		if r, ok := p.Reasons[pe.Code]; ok && pe.Code != "" {
+			pe.Reason = r
+		}
+	}
+	return pe
+}
+
+// parseRetryAfter parses a Retry-After header value, which may be either a
+// number of seconds or an HTTP date. It returns 0 if the value is absent or
+// invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// hasStatus reports whether err is a PushError with one of the given status codes.
+func hasStatus(err error, codes ...int) bool {
+	var pe *PushError
+	if !errors.As(err, &pe) {
+		return false
+	}
+	for _, code := range codes {
+		if pe.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsGone reports whether err indicates the subscription has expired or been
+// unsubscribed (410 Gone). Such subscriptions should be deleted.
+func IsGone(err error) bool {
+	return hasStatus(err, http.StatusGone)
+}
+
+// IsNotFound reports whether err is a 404 Not Found response. From
+// Client.Send, it means the subscription endpoint does not exist and the
+// subscription should be deleted. From Client.Cancel, it means only that the
+// message is gone (see ErrMessageNotFound); don't delete the subscription.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsPayloadTooLarge reports whether err indicates the payload is too large,
+// either because it failed the size check before sending (ErrPayloadTooLarge)
+// or because the push service rejected it (413 Request Entity Too Large).
+func IsPayloadTooLarge(err error) bool {
+	return errors.Is(err, ErrPayloadTooLarge) || hasStatus(err, http.StatusRequestEntityTooLarge)
+}
+
+// IsRateLimited reports whether err indicates the push service is rate
+// limiting requests (429 Too Many Requests).
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsAuthError reports whether err indicates the push service rejected the
+// VAPID credentials (401 Unauthorized or 403 Forbidden).
+func IsAuthError(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized, http.StatusForbidden)
+}
@@ -0,0 +1,63 @@
+package webpush
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPushErrorPredicates(t *testing.T) {
+	tests := []struct {
+		status int
+		check  func(error) bool
+	}{
+		{http.StatusGone, IsGone},
+		{http.StatusNotFound, IsNotFound},
+		{http.StatusRequestEntityTooLarge, IsPayloadTooLarge},
+		{http.StatusTooManyRequests, IsRateLimited},
+		{http.StatusUnauthorized, IsAuthError},
+		{http.StatusForbidden, IsAuthError},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			err := fmt.Errorf("wrapped: %w", &PushError{StatusCode: tt.status})
+			if !tt.check(err) {
+				t.Errorf("predicate(%d) = false, want true", tt.status)
+			}
+			if tt.check(&PushError{StatusCode: http.StatusInternalServerError}) {
+				t.Errorf("predicate(500) = true, want false")
+			}
+		})
+	}
+
+	if IsGone(errors.New("410 Gone")) {
+		t.Error("IsGone() matched a non-PushError")
+	}
+	if IsGone(nil) {
+		t.Error("IsGone(nil) = true, want false")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"garbage", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -13,10 +13,12 @@ import (
 	"embed"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/fs"
+	"iter"
 	"net/http"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/chainguard-dev/clog"
@@ -36,12 +38,14 @@ const (
 	dbPath    = "/tmp/subscriptions.db"
 	subject   = "mailto:admin@example.com"
 	serverURL = "http://localhost:8080"
+	pageSize  = 1000
 )
 
 var (
-	store  storage.Storage
-	client *webpush.Client
-	signer webpush.Signer
+	store       storage.Storage
+	client      *webpush.Client
+	broadcaster *webpush.Broadcaster
+	signer      webpush.Signer
 )
 
 var env = envconfig.MustProcess(context.Background(), &struct {
@@ -83,7 +87,14 @@ func main() {
 	clog.Info("SQLite storage initialized at", dbPath)
 
 	// Create web push client
-	client = webpush.NewClient(signer, subject)
+	client, err = webpush.NewClient(signer, subject)
+	if err != nil {
+		clog.Fatalf("Failed to create web push client: %v", err)
+	}
+	broadcaster, err = webpush.NewBroadcaster(client)
+	if err != nil {
+		clog.Fatalf("Failed to create broadcaster: %v", err)
+	}
 
 	// Start periodic push sender
 	go periodicPush()
@@ -120,17 +131,6 @@ func periodicPush() {
 func sendToAll(title, body string) {
 	ctx := context.Background()
 
-	records, err := store.List(ctx, 1000, 0)
-	if err != nil {
-		clog.Infof("Failed to list subscriptions: %v", err)
-		return
-	}
-
-	if len(records) == 0 {
-		clog.Info("No subscribers to notify")
-		return
-	}
-
 	payload, err := json.Marshal(map[string]string{
 		"title": title,
 		"body":  body,
@@ -141,32 +141,59 @@ func sendToAll(title, body string) {
 	}
 
 	var sent, failed int
-	for _, record := range records {
-		err := client.Send(ctx, record.Subscription, payload, &webpush.Options{
-			TTL:     3600,
-			Urgency: "normal",
-		})
-		if err != nil {
-			clog.Infof("Failed to send to %s: %v", record.ID, err)
+	var expired []string
+	for res := range broadcaster.Send(ctx, subscriptions(ctx), payload, &webpush.Options{
+		TTL:     time.Hour,
+		Urgency: webpush.Normal,
+	}) {
+		if res.Err != nil {
+			clog.Infof("Failed to send to %s: %v", res.Subscription.Endpoint, res.Err)
 			failed++
-			// Clean up expired/invalid subscriptions (410 Gone)
-			if isGone(err) {
-				if delErr := store.Delete(ctx, record.ID); delErr != nil {
-					clog.Infof("Failed to delete expired subscription: %v", delErr)
-				} else {
-					clog.Infof("Deleted expired subscription: %s", record.ID)
-				}
+			// Clean up unsubscribed, expired and invalid subscriptions
+			if webpush.ReasonOf(res.Err).SubscriptionGone() {
+				expired = append(expired, res.Subscription.Endpoint)
 			}
+			continue
+		}
+		sent++
+	}
+
+	if sent+failed == 0 {
+		clog.Info("No subscribers to notify")
+		return
+	}
+
+	// Delete after sending so pagination over the store isn't disturbed.
+	for _, endpoint := range expired {
+		if err := store.DeleteByEndpoint(ctx, endpoint); err != nil {
+			clog.Infof("Failed to delete expired subscription: %v", err)
 		} else {
-			sent++
+			clog.Infof("Deleted expired subscription: %s", endpoint)
 		}
 	}
 
 	clog.Infof("Push sent: %d successful, %d failed", sent, failed)
 }
 
-func isGone(err error) bool {
-	return err != nil && (strings.Contains(err.Error(), "410") || strings.Contains(err.Error(), "Gone"))
+// subscriptions yields every stored subscription, fetching a page at a time.
+func subscriptions(ctx context.Context) iter.Seq[*webpush.Subscription] {
+	return func(yield func(*webpush.Subscription) bool) {
+		for offset := 0; ; offset += pageSize {
+			records, err := store.List(ctx, pageSize, offset)
+			if err != nil {
+				clog.Infof("Failed to list subscriptions: %v", err)
+				return
+			}
+			for _, record := range records {
+				if !yield(record.Subscription) {
+					return
+				}
+			}
+			if len(records) < pageSize {
+				return
+			}
+		}
+	}
 }
 
 // HTTP Handlers
@@ -184,14 +211,25 @@ func handleSubscribe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var sub webpush.Subscription
-	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
-		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+	data, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
+	if err != nil {
+		http.Error(w, "Failed to read request: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if sub.Endpoint == "" || sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
-		http.Error(w, "Invalid subscription", http.StatusBadRequest)
+	sub, err := webpush.ParseSubscription(data)
+	if err != nil {
+		var ve *webpush.ValidationError
+		if errors.As(err, &ve) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{
+				"field": ve.Field,
+				"error": ve.Error(),
+			})
+			return
+		}
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -211,7 +249,7 @@ func handleSubscribe(w http.ResponseWriter, r *http.Request) {
 	// Save new subscription
 	record := &storage.Record{
 		ID:           uuid.New().String(),
-		Subscription: &sub,
+		Subscription: sub,
 	}
 
 	if err := store.Save(ctx, record); err != nil {
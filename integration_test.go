@@ -7,9 +7,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/imjasonh/webpush"
 	"github.com/imjasonh/webpush/keys"
+	"github.com/imjasonh/webpush/pushtest"
 	"github.com/imjasonh/webpush/storage"
 )
 
@@ -65,7 +67,7 @@ func TestIntegration_FullFlow(t *testing.T) {
 	// 5. Simulate client subscription
 	// In real world, this would come from the browser's PushManager.subscribe()
 	clientSubJSON := []byte(`{
-		"endpoint": "` + pushServer.URL + `/push/abc123",
+		"endpoint": "https://push.example.com/push/abc123",
 		"keys": {
 			"p256dh": "BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM",
 			"auth": "tBHItJI5svbpez7KI4CCXg"
@@ -76,6 +78,8 @@ func TestIntegration_FullFlow(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ParseSubscription() error = %v", err)
 	}
+	// ParseSubscription rejects loopback endpoints like the test server's
+	sub.Endpoint = pushServer.URL + "/push/abc123"
 
 	// 6. Store the subscription
 	record := &storage.Record{
@@ -97,8 +101,10 @@ func TestIntegration_FullFlow(t *testing.T) {
 	}
 
 	// 8. Create web push client and send notification
-	client := webpush.NewClient(signer, "mailto:test@example.com")
-	client.WithHTTPClient(pushServer.Client())
+	client, err := webpush.NewClient(signer, "mailto:test@example.com", webpush.WithHTTPClient(pushServer.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
 
 	payload := map[string]string{
 		"title": "Hello",
@@ -107,8 +113,8 @@ func TestIntegration_FullFlow(t *testing.T) {
 	payloadJSON, _ := json.Marshal(payload)
 
 	err = client.Send(context.Background(), records[0].Subscription, payloadJSON, &webpush.Options{
-		TTL:     3600,
-		Urgency: "high",
+		TTL:     time.Hour,
+		Urgency: webpush.High,
 	})
 	if err != nil {
 		t.Fatalf("Send() error = %v", err)
@@ -166,8 +172,10 @@ func TestIntegration_MultipleSubscriptions(t *testing.T) {
 	}
 
 	// Send to all user's subscriptions
-	client := webpush.NewClient(signer, "mailto:test@example.com")
-	client.WithHTTPClient(pushServer.Client())
+	client, err := webpush.NewClient(signer, "mailto:test@example.com", webpush.WithHTTPClient(pushServer.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
 
 	records, err := store.GetByUserID(ctx, "user-1")
 	if err != nil {
@@ -239,3 +247,70 @@ func TestIntegration_SQLiteStorage(t *testing.T) {
 		t.Errorf("Page 3 len = %d, want 1", len(page3))
 	}
 }
+
+// TestIntegration_PushService tests sending through the fake push service,
+// including cleanup of expired subscriptions.
+func TestIntegration_PushService(t *testing.T) {
+	privateKeyB64, _, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+	signer, err := keys.NewFileSignerFromBase64(privateKeyB64)
+	if err != nil {
+		t.Fatalf("NewFileSignerFromBase64() error = %v", err)
+	}
+
+	pushService := pushtest.NewServer()
+	defer pushService.Close()
+
+	active, err := pushService.Subscribe(signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	expired, err := pushService.Subscribe(signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	pushService.Unsubscribe(expired)
+
+	store := storage.NewMemory()
+	ctx := context.Background()
+	for i, sub := range []*webpush.Subscription{active, expired} {
+		record := &storage.Record{
+			ID:           "sub-" + string(rune('a'+i)),
+			UserID:       "user-1",
+			Subscription: sub,
+		}
+		if err := store.Save(ctx, record); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	client, err := webpush.NewClient(signer, "mailto:test@example.com", webpush.WithHTTPClient(pushService.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	records, err := store.GetByUserID(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("GetByUserID() error = %v", err)
+	}
+	for _, record := range records {
+		err := client.Send(ctx, record.Subscription, []byte(`{"title":"Hello"}`), nil)
+		if webpush.IsGone(err) {
+			if err := store.Delete(ctx, record.ID); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+		} else if err != nil {
+			t.Errorf("Send() error = %v", err)
+		}
+	}
+
+	msgs := pushService.Messages(active)
+	if len(msgs) != 1 || string(msgs[0].Payload) != `{"title":"Hello"}` {
+		t.Errorf("Messages() = %v, want one message with the payload", msgs)
+	}
+	if _, err := store.GetByEndpoint(ctx, expired.Endpoint); err == nil {
+		t.Error("expired subscription was not deleted")
+	}
+}
@@ -0,0 +1,38 @@
+package webpush
+
+import "context"
+
+// SendFunc sends a push message, as Client.SendWithResult does.
+type SendFunc func(ctx context.Context, sub *Subscription, payload []byte, opts *Options) (*SendResult, error)
+
+// SendInterceptor wraps every send made by a Client, for behavior such as
+// auditing, rate limiting or adding headers for internal relays.
+//
+// An interceptor receives the send's arguments and next, which continues the
+// chain. It may change the arguments before calling next, inspect or replace
+// the result and error it returns, or return without calling next to skip
+// the send entirely. opts is never nil; it is the caller's Options merged
+// with the Client's defaults, and is a copy the interceptor may modify.
+type SendInterceptor func(ctx context.Context, sub *Subscription, payload []byte, opts *Options, next SendFunc) (*SendResult, error)
+
+// WithInterceptors adds interceptors around every send. They run in the
+// order given, the first outermost, after any added by earlier options.
+// Sends made by a Broadcaster pass through them too.
+func WithInterceptors(interceptors ...SendInterceptor) ClientOption {
+	return func(c *Client) error {
+		c.interceptors = append(c.interceptors, interceptors...)
+		return nil
+	}
+}
+
+// chain returns a SendFunc that runs interceptors around send, the first
+// outermost.
+func chain(interceptors []SendInterceptor, send SendFunc) SendFunc {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], send
+		send = func(ctx context.Context, sub *Subscription, payload []byte, opts *Options) (*SendResult, error) {
+			return interceptor(ctx, sub, payload, opts, next)
+		}
+	}
+	return send
+}
@@ -0,0 +1,180 @@
+package webpush
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClient_Interceptors(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	var calls []string
+	record := func(name string) SendInterceptor {
+		return func(ctx context.Context, sub *Subscription, payload []byte, opts *Options, next SendFunc) (*SendResult, error) {
+			calls = append(calls, name+" before")
+			result, err := next(ctx, sub, payload, opts)
+			calls = append(calls, name+" after")
+			return result, err
+		}
+	}
+	relay := func(ctx context.Context, sub *Subscription, payload []byte, opts *Options, next SendFunc) (*SendResult, error) {
+		if opts.Header == nil {
+			opts.Header = make(http.Header)
+		}
+		opts.Header.Set("X-Relay-Token", "secret")
+		opts.Header.Set("TTL", "1") // Can't replace the Client's headers
+		opts.Urgency = High
+		return next(ctx, sub, payload, opts)
+	}
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc123")
+	client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com",
+		WithDefaultOptions(Options{TTL: time.Hour}),
+		WithInterceptors(record("outer"), record("middle")),
+		WithInterceptors(relay, record("inner")),
+		WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	opts := &Options{Topic: "news"}
+	result, err := client.SendWithResult(context.Background(), sub, []byte("test"), opts)
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if result.StatusCode != http.StatusCreated {
+		t.Errorf("StatusCode = %d, want %d", result.StatusCode, http.StatusCreated)
+	}
+
+	want := []string{"outer before", "middle before", "inner before", "inner after", "middle after", "outer after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	h := <-headers
+	if got := h.Get("X-Relay-Token"); got != "secret" {
+		t.Errorf("X-Relay-Token = %q, want %q", got, "secret")
+	}
+	if got := h.Get("TTL"); got != "3600" {
+		t.Errorf("TTL = %q, want %q", got, "3600")
+	}
+	if got := h.Get("Urgency"); got != "high" {
+		t.Errorf("Urgency = %q, want %q", got, "high")
+	}
+	if got := h.Get("Topic"); got != "news" {
+		t.Errorf("Topic = %q, want %q", got, "news")
+	}
+
+	// Interceptors modify a copy of the caller's options
+	if opts.Header != nil || opts.Urgency != "" {
+		t.Errorf("caller's options modified: %+v", opts)
+	}
+}
+
+func TestClient_InterceptorShortCircuit(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	errLimited := errors.New("rate limited")
+	limit := func(ctx context.Context, sub *Subscription, payload []byte, opts *Options, next SendFunc) (*SendResult, error) {
+		return nil, errLimited
+	}
+	var reached bool
+	after := func(ctx context.Context, sub *Subscription, payload []byte, opts *Options, next SendFunc) (*SendResult, error) {
+		reached = true
+		return next(ctx, sub, payload, opts)
+	}
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc123")
+	client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com",
+		WithInterceptors(limit, after),
+		WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.Send(context.Background(), sub, []byte("test"), nil); !errors.Is(err, errLimited) {
+		t.Errorf("Send() error = %v, want %v", err, errLimited)
+	}
+	if reached {
+		t.Error("interceptor after short circuit was called")
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("push service received %d requests, want 0", n)
+	}
+}
+
+func TestClient_InterceptorSeesErrors(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	var seen error
+	audit := func(ctx context.Context, sub *Subscription, payload []byte, opts *Options, next SendFunc) (*SendResult, error) {
+		result, err := next(ctx, sub, payload, opts)
+		seen = err
+		return result, err
+	}
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc123")
+	client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com",
+		WithInterceptors(audit),
+		WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	err = client.Send(context.Background(), sub, []byte("test"), nil)
+	if err == nil || seen != err {
+		t.Errorf("interceptor saw %v, Send() returned %v", seen, err)
+	}
+	if !ReasonOf(seen).SubscriptionGone() {
+		t.Errorf("ReasonOf() = %q, want a gone subscription", ReasonOf(seen))
+	}
+}
+
+func TestWithDefaultOptions_CopiesHeader(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc123")
+	h := http.Header{"X-Relay-Token": {"secret"}}
+	client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com",
+		WithDefaultOptions(Options{Header: h}),
+		WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	h.Set("X-Relay-Token", "changed")
+
+	if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got := (<-headers).Get("X-Relay-Token"); got != "secret" {
+		t.Errorf("X-Relay-Token = %q, want %q", got, "secret")
+	}
+}
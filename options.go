@@ -0,0 +1,153 @@
+package webpush
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/imjasonh/webpush/vapid"
+)
+
+const (
+	defaultVAPIDExpiration = 12 * time.Hour
+
+	// MaxVAPIDExpiration is the longest VAPID JWT lifetime permitted by
+	// RFC 8292.
+	MaxVAPIDExpiration = vapid.MaxExpiration
+)
+
+// VAPIDScheme selects the format of the VAPID authentication headers.
+type VAPIDScheme int
+
+const (
+	// VAPIDSchemeAuto uses VAPIDSchemeWebPush for messages encrypted with
+	// the legacy aesgcm encoding and VAPIDSchemeRFC8292 otherwise. It is
+	// the default.
+	VAPIDSchemeAuto VAPIDScheme = iota
+
+	// VAPIDSchemeRFC8292 sends "Authorization: vapid t=<jwt>, k=<key>", as
+	// defined by RFC 8292.
+	VAPIDSchemeRFC8292
+
+	// VAPIDSchemeWebPush sends "Authorization: WebPush <jwt>" with the
+	// public key in "Crypto-Key: p256ecdsa=<key>", as defined by earlier
+	// drafts of RFC 8292 and still expected by some push services.
+	VAPIDSchemeWebPush
+)
+
+// resolve returns the concrete scheme to use for a message with the given
+// content encoding.
+func (s VAPIDScheme) resolve(encoding ContentEncoding) VAPIDScheme {
+	if s != VAPIDSchemeAuto {
+		return s
+	}
+	if encoding == AESGCM {
+		return VAPIDSchemeWebPush
+	}
+	return VAPIDSchemeRFC8292
+}
+
+// ClientOption configures a Client created by NewClient.
+type ClientOption func(*Client) error
+
+// WithVAPIDExpiration sets how long signed VAPID JWTs are valid for. It must
+// be positive and no longer than MaxVAPIDExpiration. The default is 12 hours.
+func WithVAPIDExpiration(d time.Duration) ClientOption {
+	return func(c *Client) error {
+		if d <= 0 || d > MaxVAPIDExpiration {
+			return fmt.Errorf("VAPID expiration must be between 0 and %v, got %v", MaxVAPIDExpiration, d)
+		}
+		c.vapidExpiration = d
+		return nil
+	}
+}
+
+// WithVAPIDClaims adds claims to every VAPID JWT. The aud, exp and sub
+// claims are set by the Client and can't be overridden.
+func WithVAPIDClaims(claims map[string]any) ClientOption {
+	return func(c *Client) error {
+		for _, reserved := range []string{"aud", "exp", "sub"} {
+			if _, ok := claims[reserved]; ok {
+				return fmt.Errorf("VAPID claim %q is reserved", reserved)
+			}
+		}
+		c.extraClaims = make(map[string]any, len(claims))
+		for k, v := range claims {
+			c.extraClaims[k] = v
+		}
+		return nil
+	}
+}
+
+// WithVAPIDScheme sets the format of the VAPID authentication headers. The
+// default is VAPIDSchemeAuto.
+func WithVAPIDScheme(s VAPIDScheme) ClientOption {
+	return func(c *Client) error {
+		if s < VAPIDSchemeAuto || s > VAPIDSchemeWebPush {
+			return fmt.Errorf("unknown VAPID scheme %d", s)
+		}
+		c.vapidScheme = s
+		return nil
+	}
+}
+
+// WithClock sets the function used to get the current time, which determines
+// VAPID JWT expiration. It is intended for tests.
+func WithClock(now func() time.Time) ClientOption {
+	return func(c *Client) error {
+		if now == nil {
+			return errors.New("clock must not be nil")
+		}
+		c.now = now
+		return nil
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send requests, replacing the
+// default transport; see WithTransport.
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) error {
+		if httpClient == nil {
+			return errors.New("HTTP client must not be nil")
+		}
+		c.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry transient send failures.
+// By default, failed sends are not retried.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) error {
+		c.retryPolicy = policy
+		return nil
+	}
+}
+
+// WithTokenCache configures caching of signed VAPID tokens. Passing
+// TokenCacheOptions with Disabled set signs a new token for every send.
+func WithTokenCache(opts TokenCacheOptions) ClientOption {
+	return func(c *Client) error {
+		if opts.Disabled {
+			c.tokenCache = nil
+		} else {
+			c.tokenCache = newTokenCache(opts)
+		}
+		return nil
+	}
+}
+
+// WithDefaultOptions sets the Options used for every send. Fields set in the
+// Options passed to a send take precedence; zero fields fall back to these
+// defaults. Invalid defaults are reported as a *ValidationError.
+func WithDefaultOptions(opts Options) ClientOption {
+	return func(c *Client) error {
+		if err := opts.validate(); err != nil {
+			return err
+		}
+		opts.Header = opts.Header.Clone()
+		c.defaults = opts
+		return nil
+	}
+}
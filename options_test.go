@@ -0,0 +1,247 @@
+package webpush
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imjasonh/webpush/vapid"
+)
+
+func TestNewClient_Subject(t *testing.T) {
+	tests := []struct {
+		subject string
+		wantErr bool
+	}{
+		{"mailto:admin@example.com", false},
+		{"https://example.com/contact", false},
+		{"", true},
+		{"admin@example.com", true},
+		{"mailto:", true},
+		{"mailto:not-an-address", true},
+		{"mailto:Admin <admin@example.com>", true},
+		{"http://example.com", true},
+		{"https://", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subject, func(t *testing.T) {
+			_, err := NewClient(&mockSigner{}, tt.subject)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient(%q) error = %v, wantErr %v", tt.subject, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClient_Options(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     ClientOption
+		wantErr bool
+	}{
+		{"expiration", WithVAPIDExpiration(time.Hour), false},
+		{"max expiration", WithVAPIDExpiration(MaxVAPIDExpiration), false},
+		{"expiration too long", WithVAPIDExpiration(25 * time.Hour), true},
+		{"zero expiration", WithVAPIDExpiration(0), true},
+		{"claims", WithVAPIDClaims(map[string]any{"team": "alerts"}), false},
+		{"reserved claim", WithVAPIDClaims(map[string]any{"sub": "mailto:x@example.com"}), true},
+		{"nil clock", WithClock(nil), true},
+		{"legacy scheme", WithVAPIDScheme(VAPIDSchemeWebPush), false},
+		{"unknown scheme", WithVAPIDScheme(VAPIDScheme(42)), true},
+		{"nil HTTP client", WithHTTPClient(nil), true},
+		{"default options", WithDefaultOptions(Options{Urgency: High, TTL: time.Hour}), false},
+		{"invalid default options", WithDefaultOptions(Options{Topic: "not a topic"}), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(&mockSigner{}, "mailto:test@example.com", tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_VAPIDClaims(t *testing.T) {
+	authHeaders := make(chan string, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authHeaders <- r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	p256dhBytes, _ := base64.RawURLEncoding.DecodeString("BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM")
+	sub := &Subscription{
+		Endpoint: server.URL + "/push/abc123",
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(p256dhBytes),
+			Auth:   base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+		},
+	}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	client, err := NewClient(&mockSigner{pubKey: p256dhBytes}, "https://example.com/contact",
+		WithVAPIDExpiration(2*time.Hour),
+		WithVAPIDClaims(map[string]any{"team": "alerts"}),
+		WithClock(func() time.Time { return now }),
+		WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	// Authorization: vapid t=<header>.<claims>.<signature>, k=<key>
+	auth := <-authHeaders
+	token := strings.TrimPrefix(strings.SplitN(auth, ",", 2)[0], "vapid t=")
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("JWT has %d parts, want 3", len(parts))
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("decoding claims: %v", err)
+	}
+	var claims struct {
+		Aud  string `json:"aud"`
+		Exp  int64  `json:"exp"`
+		Sub  string `json:"sub"`
+		Team string `json:"team"`
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		t.Fatalf("unmarshaling claims: %v", err)
+	}
+
+	if claims.Aud != server.URL {
+		t.Errorf("aud = %q, want %q", claims.Aud, server.URL)
+	}
+	if want := now.Add(2 * time.Hour).Unix(); claims.Exp != want {
+		t.Errorf("exp = %d, want %d", claims.Exp, want)
+	}
+	if claims.Sub != "https://example.com/contact" {
+		t.Errorf("sub = %q, want %q", claims.Sub, "https://example.com/contact")
+	}
+	if claims.Team != "alerts" {
+		t.Errorf("team = %q, want %q", claims.Team, "alerts")
+	}
+}
+
+func TestClient_DefaultOptions(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc123")
+	client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com",
+		WithDefaultOptions(Options{TTL: time.Hour, Urgency: High, Topic: "default"}),
+		WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		opts        *Options
+		wantTTL     string
+		wantUrgency string
+		wantTopic   string
+	}{
+		{"defaults", nil, "3600", "high", "default"},
+		{"empty options", &Options{}, "3600", "high", "default"},
+		{"overrides", &Options{TTL: time.Minute, Urgency: Low}, "60", "low", "default"},
+		{"zero TTL", &Options{TTL: ZeroTTL, Topic: "other"}, "0", "high", "other"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := client.Send(context.Background(), sub, []byte("test"), tt.opts); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			h := <-headers
+			if got := h.Get("TTL"); got != tt.wantTTL {
+				t.Errorf("TTL = %q, want %q", got, tt.wantTTL)
+			}
+			if got := h.Get("Urgency"); got != tt.wantUrgency {
+				t.Errorf("Urgency = %q, want %q", got, tt.wantUrgency)
+			}
+			if got := h.Get("Topic"); got != tt.wantTopic {
+				t.Errorf("Topic = %q, want %q", got, tt.wantTopic)
+			}
+		})
+	}
+}
+
+func TestClient_VAPIDScheme(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	p256dhBytes, _ := base64.RawURLEncoding.DecodeString("BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM")
+	sub := &Subscription{
+		Endpoint: server.URL + "/push/abc123",
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(p256dhBytes),
+			Auth:   base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+		},
+	}
+
+	tests := []struct {
+		name       string
+		scheme     VAPIDScheme
+		encoding   ContentEncoding
+		wantLegacy bool
+	}{
+		{"auto aes128gcm", VAPIDSchemeAuto, AES128GCM, false},
+		{"auto aesgcm", VAPIDSchemeAuto, AESGCM, true},
+		{"rfc8292 aesgcm", VAPIDSchemeRFC8292, AESGCM, false},
+		{"webpush aes128gcm", VAPIDSchemeWebPush, AES128GCM, true},
+		{"webpush aesgcm", VAPIDSchemeWebPush, AESGCM, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(&mockSigner{pubKey: p256dhBytes}, "mailto:test@example.com", WithVAPIDScheme(tt.scheme), WithHTTPClient(server.Client()))
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+
+			if err := client.Send(context.Background(), sub, []byte("test"), &Options{ContentEncoding: tt.encoding}); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			h := <-headers
+
+			parsed, err := vapid.ParseHeader(h)
+			if err != nil {
+				t.Fatalf("vapid.ParseHeader() error = %v", err)
+			}
+			if parsed.Legacy != tt.wantLegacy {
+				t.Errorf("Legacy = %v, want %v (Authorization: %q)", parsed.Legacy, tt.wantLegacy, h.Get("Authorization"))
+			}
+			if string(parsed.PublicKey) != string(p256dhBytes) {
+				t.Errorf("PublicKey = %x, want %x", parsed.PublicKey, p256dhBytes)
+			}
+
+			// The aesgcm encoding's dh parameter must survive alongside p256ecdsa.
+			if tt.encoding == AESGCM && !strings.HasPrefix(h.Get("Crypto-Key"), "dh=") {
+				t.Errorf("Crypto-Key = %q, want dh parameter", h.Get("Crypto-Key"))
+			}
+		})
+	}
+}
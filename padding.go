@@ -0,0 +1,103 @@
+package webpush
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxRecordSize is the largest encrypted payload push services are required
+// to accept (RFC 8030 section 7.2). Larger payloads are rejected with
+// ErrPayloadTooLarge before sending.
+const MaxRecordSize = 4096
+
+// Padding decides how many bytes of padding to add to a push message so that
+// its encrypted size doesn't reveal the length of its contents.
+type Padding interface {
+	// Length returns the number of padding bytes to add to a plaintext of
+	// length n. The result is clamped so that n plus padding never exceeds
+	// maxLen, the largest plaintext the encoding can carry.
+	Length(n, maxLen int, rand io.Reader) (int, error)
+}
+
+type paddingFunc func(n, maxLen int, rand io.Reader) (int, error)
+
+func (f paddingFunc) Length(n, maxLen int, rand io.Reader) (int, error) { return f(n, maxLen, rand) }
+
+// PadToMultiple pads messages up to the next multiple of size bytes, so that
+// all messages within a bucket have the same encrypted length.
+func PadToMultiple(size int) Padding {
+	return paddingFunc(func(n, _ int, _ io.Reader) (int, error) {
+		if size <= 0 {
+			return 0, fmt.Errorf("padding bucket size must be positive, got %d", size)
+		}
+		if rem := n % size; rem != 0 {
+			return size - rem, nil
+		}
+		return 0, nil
+	})
+}
+
+// PadToMax pads every message to the largest size the encoding allows, so
+// that all messages have the same encrypted length.
+func PadToMax() Padding {
+	return paddingFunc(func(n, maxLen int, _ io.Reader) (int, error) {
+		return maxLen - n, nil
+	})
+}
+
+// PadRandom adds a uniformly random amount of padding between 0 and limit
+// bytes.
+func PadRandom(limit int) Padding {
+	return paddingFunc(func(_, _ int, r io.Reader) (int, error) {
+		if limit <= 0 {
+			return 0, nil
+		}
+		var b [4]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return 0, fmt.Errorf("reading random padding length: %w", err)
+		}
+		return int(binary.BigEndian.Uint32(b[:]) % uint32(limit+1)), nil
+	})
+}
+
+// MaxPlaintextSize returns the largest payload, in bytes, that can be sent
+// with the given options. Padding never causes a payload within this limit
+// to be rejected, since padding is reduced to fit.
+func MaxPlaintextSize(opts *Options) int {
+	if opts == nil {
+		return maxPlaintext(AES128GCM)
+	}
+	return maxPlaintext(opts.ContentEncoding)
+}
+
+// maxPlaintext returns the largest plaintext, including padding, that fits
+// in a single push message with the given encoding.
+func maxPlaintext(encoding ContentEncoding) int {
+	if encoding == AESGCM {
+		// Two-byte padding length and 16-byte authentication tag.
+		return MaxRecordSize - 2 - 16
+	}
+	// 86-byte header, padding delimiter and 16-byte authentication tag.
+	return MaxRecordSize - 86 - 1 - 16
+}
+
+// paddingLength returns the padding to add to a plaintext of length n.
+func paddingLength(p Padding, n int, encoding ContentEncoding, random io.Reader) (int, error) {
+	if p == nil {
+		return 0, nil
+	}
+	limit := maxPlaintext(encoding)
+	if encoding == AESGCM {
+		limit = min(limit, n+0xffff) // Padding length is a uint16
+	}
+	if n >= limit {
+		return 0, nil
+	}
+
+	pad, err := p.Length(n, limit, random)
+	if err != nil {
+		return 0, err
+	}
+	return min(max(pad, 0), limit-n), nil
+}
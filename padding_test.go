@@ -0,0 +1,167 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// stripAESGCMPadding removes aesgcm padding from a record, returning the
+// plaintext and the number of padding bytes.
+func stripAESGCMPadding(t *testing.T, record []byte) ([]byte, int) {
+	t.Helper()
+	padLen := int(binary.BigEndian.Uint16(record))
+	if !bytes.Equal(record[2:2+padLen], make([]byte, padLen)) {
+		t.Fatalf("padding is not all zeros")
+	}
+	return record[2+padLen:], padLen
+}
+
+func TestPadding(t *testing.T) {
+	plaintext := []byte("a secret of some length")
+
+	tests := []struct {
+		name        string
+		padding     Padding
+		wantLen     func(encoding ContentEncoding) int // plaintext + padding
+		randomRange int
+	}{{
+		name:    "none",
+		padding: nil,
+		wantLen: func(ContentEncoding) int { return len(plaintext) },
+	}, {
+		name:    "multiple",
+		padding: PadToMultiple(64),
+		wantLen: func(ContentEncoding) int { return 64 },
+	}, {
+		name:    "max",
+		padding: PadToMax(),
+		wantLen: maxPlaintext,
+	}, {
+		name:        "random",
+		padding:     PadRandom(100),
+		randomRange: 100,
+	}}
+
+	for _, tt := range tests {
+		for _, encoding := range []ContentEncoding{AES128GCM, AESGCM} {
+			t.Run(tt.name+"/"+string(encoding), func(t *testing.T) {
+				sub, priv, auth := newTestSubscriber(t, "https://push.example.com/abc")
+				encrypted, err := Encrypt(sub, plaintext, &EncryptOptions{ContentEncoding: encoding, Padding: tt.padding})
+				if err != nil {
+					t.Fatalf("Encrypt() error = %v", err)
+				}
+
+				var got []byte
+				var padLen int
+				if encoding == AESGCM {
+					header := make(http.Header)
+					encrypted.SetHeaders(header)
+					got, padLen = stripAESGCMPadding(t, decryptAESGCM(t, priv, auth, header, encrypted.Body))
+				} else {
+					if got, err = Decrypt(priv, auth, encrypted.Body); err != nil {
+						t.Fatalf("Decrypt() error = %v", err)
+					}
+					// Header, delimiter and tag account for the remaining bytes.
+					padLen = len(encrypted.Body) - MaxRecordSize + maxPlaintext(AES128GCM) - len(got)
+				}
+
+				if !bytes.Equal(got, plaintext) {
+					t.Errorf("plaintext = %q, want %q", got, plaintext)
+				}
+				if tt.randomRange > 0 {
+					if padLen > tt.randomRange {
+						t.Errorf("padding = %d, want <= %d", padLen, tt.randomRange)
+					}
+				} else if want := tt.wantLen(encoding); len(plaintext)+padLen != want {
+					t.Errorf("padded length = %d, want %d", len(plaintext)+padLen, want)
+				}
+				if len(encrypted.Body) > MaxRecordSize {
+					t.Errorf("encrypted size = %d, want <= %d", len(encrypted.Body), MaxRecordSize)
+				}
+			})
+		}
+	}
+}
+
+func TestPaddingLength_Clamped(t *testing.T) {
+	limit := maxPlaintext(AES128GCM)
+
+	// A bucket larger than the maximum is clamped to the maximum.
+	pad, err := paddingLength(PadToMultiple(10000), 100, AES128GCM, rand.Reader)
+	if err != nil {
+		t.Fatalf("paddingLength() error = %v", err)
+	}
+	if pad != limit-100 {
+		t.Errorf("paddingLength() = %d, want %d", pad, limit-100)
+	}
+
+	// Plaintext already at the limit gets no padding.
+	pad, err = paddingLength(PadRandom(1000), limit, AES128GCM, rand.Reader)
+	if err != nil {
+		t.Fatalf("paddingLength() error = %v", err)
+	}
+	if pad != 0 {
+		t.Errorf("paddingLength() = %d, want 0", pad)
+	}
+
+	if _, err := PadToMultiple(0).Length(10, limit, rand.Reader); err == nil {
+		t.Error("PadToMultiple(0) expected error")
+	}
+}
+
+func TestPadRandom_Distribution(t *testing.T) {
+	seen := make(map[int]bool)
+	for range 200 {
+		pad, err := PadRandom(3).Length(0, 100, rand.Reader)
+		if err != nil {
+			t.Fatalf("Length() error = %v", err)
+		}
+		if pad < 0 || pad > 3 {
+			t.Fatalf("Length() = %d, want in [0, 3]", pad)
+		}
+		seen[pad] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("saw padding lengths %v, want all of 0-3", seen)
+	}
+
+	if _, err := PadRandom(3).Length(0, 100, io.LimitReader(rand.Reader, 0)); err == nil {
+		t.Error("Length() expected error when randomness is exhausted")
+	}
+}
+
+func TestMaxPlaintextSize(t *testing.T) {
+	for _, encoding := range []ContentEncoding{AES128GCM, AESGCM} {
+		t.Run(string(encoding), func(t *testing.T) {
+			sub, _, _ := newTestSubscriber(t, "https://push.example.com/abc")
+			opts := &Options{ContentEncoding: encoding, Padding: PadToMultiple(128)}
+			limit := MaxPlaintextSize(opts)
+
+			encrypted, err := Encrypt(sub, make([]byte, limit), &EncryptOptions{ContentEncoding: opts.ContentEncoding, Padding: opts.Padding})
+			if err != nil {
+				t.Fatalf("Encrypt(%d bytes) error = %v", limit, err)
+			}
+			if len(encrypted.Body) != MaxRecordSize {
+				t.Errorf("encrypted size = %d, want %d", len(encrypted.Body), MaxRecordSize)
+			}
+
+			_, err = Encrypt(sub, make([]byte, limit+1), &EncryptOptions{ContentEncoding: opts.ContentEncoding, Padding: opts.Padding})
+			var tooLarge *PayloadTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("Encrypt(%d bytes) error = %v, want *PayloadTooLargeError", limit+1, err)
+			}
+			if tooLarge.Size != MaxRecordSize+1 || tooLarge.Max != MaxRecordSize {
+				t.Errorf("PayloadTooLargeError = %+v, want Size %d, Max %d", tooLarge, MaxRecordSize+1, MaxRecordSize)
+			}
+		})
+	}
+
+	if got, want := MaxPlaintextSize(nil), 3993; got != want {
+		t.Errorf("MaxPlaintextSize(nil) = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package webpush
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Provider identifies the push service operator a subscription belongs to.
+type Provider string
+
+// Known push services.
+const (
+	ProviderUnknown Provider = ""
+	ProviderFCM     Provider = "fcm"     // Firebase Cloud Messaging (Chrome, Edge, most Android browsers)
+	ProviderMozilla Provider = "mozilla" // Mozilla autopush (Firefox)
+	ProviderApple   Provider = "apple"   // Apple Push Notification service (Safari)
+	ProviderWNS     Provider = "wns"     // Windows Push Notification Services (legacy Edge)
+)
+
+// Profile describes the quirks of a push service.
+type Profile struct {
+	Provider Provider
+
+	// Hosts are the endpoint hosts served by the push service. An entry
+	// beginning with "*." matches any subdomain.
+	Hosts []string
+
+	// ValidateSubject checks the Client's VAPID subject against the push
+	// service's stricter rules, if any. Sends to the push service fail
+	// with a *ValidationError before any request is made if it returns an
+	// error. It may be nil.
+	ValidateSubject func(subject string) error
+
+	// ParseError extracts the provider-specific error code and message
+	// from an error response, if any. It may be nil.
+	ParseError func(header http.Header, body []byte) (code, message string)
+
+	// Reasons maps error codes returned by ParseError to reasons. Codes
+	// that aren't listed are classified by status code.
+	Reasons map[string]Reason
+}
+
+// matches reports whether the profile serves endpoints on host.
+func (p *Profile) matches(host string) bool {
+	for _, h := range p.Hosts {
+		if suffix, ok := strings.CutPrefix(h, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	profilesMu sync.RWMutex
+	profiles   = []*Profile{
+		{
+			Provider:   ProviderFCM,
+			Hosts:      []string{"fcm.googleapis.com", "android.googleapis.com"},
+			ParseError: parseFCMError,
+			Reasons:    fcmReasons,
+		},
+		{
+			Provider:   ProviderMozilla,
+			Hosts:      []string{"*.push.services.mozilla.com"},
+			ParseError: parseMozillaError,
+			Reasons:    mozillaReasons,
+		},
+		{
+			Provider:        ProviderApple,
+			Hosts:           []string{"*.push.apple.com"},
+			ValidateSubject: validateAppleSubject,
+			ParseError:      parseAppleError,
+			Reasons:         appleReasons,
+		},
+		{
+			Provider:   ProviderWNS,
+			Hosts:      []string{"*.notify.windows.com"},
+			ParseError: parseWNSError,
+		},
+	}
+)
+
+// RegisterProfile adds a push service profile, or replaces the profile for
+// the same Provider. Profiles registered later take precedence when their
+// hosts overlap. Hosts are matched case-insensitively. It is typically called
+// from an init function, and panics if p.Provider is empty.
+func RegisterProfile(p Profile) {
+	if p.Provider == ProviderUnknown {
+		panic("webpush: RegisterProfile with empty Provider")
+	}
+	hosts := make([]string, len(p.Hosts))
+	for i, h := range p.Hosts {
+		hosts[i] = strings.ToLower(h)
+	}
+	p.Hosts = hosts
+
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	for i, existing := range profiles {
+		if existing.Provider == p.Provider {
+			profiles = append(profiles[:i:i], profiles[i+1:]...)
+			break
+		}
+	}
+	profiles = append([]*Profile{&p}, profiles...)
+}
+
+// lookupProfile returns the profile for the push service hosting endpoint,
+// or nil if it isn't known.
+func lookupProfile(endpoint string) *Profile {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	for _, p := range profiles {
+		if p.matches(host) {
+			return p
+		}
+	}
+	return nil
+}
+
+// DetectProvider returns the push service hosting endpoint, based on its
+// host, or ProviderUnknown.
+func DetectProvider(endpoint string) Provider {
+	if p := lookupProfile(endpoint); p != nil {
+		return p.Provider
+	}
+	return ProviderUnknown
+}
+
+// Provider returns the push service the subscription belongs to.
+func (s *Subscription) Provider() Provider {
+	return DetectProvider(s.Endpoint)
+}
+
+// validateAppleSubject rejects subjects that APNs refuses with BadJwtToken:
+// a localhost https: URL or mailto: address, commonly left over from
+// development.
+func validateAppleSubject(subject string) error {
+	u, err := url.Parse(subject)
+	if err != nil {
+		return err
+	}
+	host := u.Hostname()
+	if u.Scheme == "mailto" {
+		_, host, _ = strings.Cut(u.Opaque, "@")
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.New("Apple rejects localhost subjects")
+	}
+	return nil
+}
+
+// parseFCMError parses a Google API error, such as
+// {"error": {"code": 404, "message": "...", "status": "NOT_FOUND"}}. FCM's
+// legacy web push endpoints respond with plain text instead.
+func parseFCMError(_ http.Header, body []byte) (string, string) {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", strings.TrimSpace(string(body))
+	}
+	code := resp.Error.Status
+	for _, d := range resp.Error.Details {
+		if d.ErrorCode != "" {
+			code = d.ErrorCode
+			break
+		}
+	}
+	return code, resp.Error.Message
+}
+
+// parseMozillaError parses an autopush error, such as
+// {"code": 410, "errno": 106, "error": "Gone", "message": "..."}. The code
+// is the errno.
+func parseMozillaError(_ http.Header, body []byte) (string, string) {
+	var resp struct {
+		Errno   int    `json:"errno"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Errno == 0 {
+		return "", ""
+	}
+	return strconv.Itoa(resp.Errno), resp.Message
+}
+
+// parseAppleError parses an APNs error, such as {"reason": "BadJwtToken"}.
+// The code is the reason.
+func parseAppleError(_ http.Header, body []byte) (string, string) {
+	var resp struct {
+		Reason string `json:"reason"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", ""
+	}
+	return resp.Reason, ""
+}
+
+// parseWNSError reads the error description WNS returns in a header.
+func parseWNSError(header http.Header, _ []byte) (string, string) {
+	return "", header.Get("X-WNS-Error-Description")
+}
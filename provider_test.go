@@ -0,0 +1,214 @@
+package webpush
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDetectProvider(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     Provider
+	}{
+		{"https://fcm.googleapis.com/fcm/send/abc", ProviderFCM},
+		{"https://android.googleapis.com/gcm/send/abc", ProviderFCM},
+		{"https://updates.push.services.mozilla.com/wpush/v2/abc", ProviderMozilla},
+		{"https://web.push.apple.com/abc", ProviderApple},
+		{"https://WEB.PUSH.APPLE.COM/abc", ProviderApple},
+		{"https://wns2-par02p.notify.windows.com/w/?token=abc", ProviderWNS},
+		{"https://push.example.com/abc", ProviderUnknown},
+		{"https://evilpush.apple.com.example.com/abc", ProviderUnknown},
+		{"https://notfcm.googleapis.com/abc", ProviderUnknown},
+		{"::not a url", ProviderUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			if got := DetectProvider(tt.endpoint); got != tt.want {
+				t.Errorf("DetectProvider(%q) = %q, want %q", tt.endpoint, got, tt.want)
+			}
+			sub := &Subscription{Endpoint: tt.endpoint}
+			if got := sub.Provider(); got != tt.want {
+				t.Errorf("Subscription.Provider() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPushError_Profiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		endpoint    string
+		header      http.Header
+		body        string
+		wantCode    string
+		wantMessage string
+		wantReason  Reason
+	}{{
+		name:        "mozilla",
+		endpoint:    "https://updates.push.services.mozilla.com/wpush/v2/abc",
+		body:        `{"code": 410, "errno": 106, "error": "Gone", "message": "Request did not validate UAID not found"}`,
+		wantCode:    "106",
+		wantMessage: "Request did not validate UAID not found",
+		wantReason:  ReasonUnsubscribed,
+	}, {
+		name:       "apple",
+		endpoint:   "https://web.push.apple.com/abc",
+		body:       `{"reason": "BadJwtToken"}`,
+		wantCode:   "BadJwtToken",
+		wantReason: ReasonBadJWT,
+	}, {
+		name:        "fcm json",
+		endpoint:    "https://fcm.googleapis.com/fcm/send/abc",
+		body:        `{"error": {"code": 404, "message": "Requested entity was not found.", "status": "NOT_FOUND", "details": [{"errorCode": "UNREGISTERED"}]}}`,
+		wantCode:    "UNREGISTERED",
+		wantMessage: "Requested entity was not found.",
+		wantReason:  ReasonUnsubscribed,
+	}, {
+		name:        "fcm text",
+		endpoint:    "https://fcm.googleapis.com/fcm/send/abc",
+		body:        "the key in the authorization header does not correspond to the sender ID\n",
+		wantMessage: "the key in the authorization header does not correspond to the sender ID",
+		wantReason:  ReasonUnsubscribed, // from the 410 status
+	}, {
+		name:        "wns",
+		endpoint:    "https://wns2-par02p.notify.windows.com/w/?token=abc",
+		header:      http.Header{"X-Wns-Error-Description": {"Token expired"}},
+		wantMessage: "Token expired",
+		wantReason:  ReasonUnsubscribed,
+	}, {
+		name:       "unknown",
+		endpoint:   "https://push.example.com/abc",
+		body:       `{"errno": 106}`,
+		wantReason: ReasonUnsubscribed,
+	}, {
+		name:        "unlisted errno",
+		endpoint:    "https://updates.push.services.mozilla.com/wpush/v2/abc",
+		body:        `{"code": 410, "errno": 999, "message": "Unknown error"}`,
+		wantCode:    "999",
+		wantReason:  ReasonUnsubscribed,
+		wantMessage: "Unknown error",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			resp := &http.Response{StatusCode: http.StatusGone, Header: header}
+			pe := newPushError(resp, []byte(tt.body), tt.endpoint)
+
+			if want := DetectProvider(tt.endpoint); pe.Provider != want {
+				t.Errorf("Provider = %q, want %q", pe.Provider, want)
+			}
+			if pe.Code != tt.wantCode || pe.Message != tt.wantMessage {
+				t.Errorf("Code, Message = %q, %q, want %q, %q", pe.Code, pe.Message, tt.wantCode, tt.wantMessage)
+			}
+			if pe.Reason != tt.wantReason {
+				t.Errorf("Reason = %q, want %q", pe.Reason, tt.wantReason)
+			}
+			if tt.wantCode != "" && !strings.Contains(pe.Error(), tt.wantCode) {
+				t.Errorf("Error() = %q, want it to contain %q", pe.Error(), tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestRegisterProfile(t *testing.T) {
+	saved := profiles
+	t.Cleanup(func() { profiles = saved })
+
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	RegisterProfile(Profile{
+		Provider: "test",
+		Hosts:    []string{"127.0.0.1"},
+		ValidateSubject: func(subject string) error {
+			if !strings.HasPrefix(subject, "https:") {
+				return errors.New("must be an https: URL")
+			}
+			return nil
+		},
+	})
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc123")
+	if got := sub.Provider(); got != "test" {
+		t.Fatalf("Provider() = %q, want %q", got, "test")
+	}
+
+	client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com", WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	var ve *ValidationError
+	if err := client.Send(context.Background(), sub, []byte("test"), nil); !errors.As(err, &ve) || ve.Field != "subject" {
+		t.Errorf("Send() error = %v, want a *ValidationError for subject", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("push service received %d requests, want 0", n)
+	}
+
+	client, err = NewClient(&mockSigner{pubKey: []byte("key")}, "https://example.com/contact", WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+		t.Errorf("Send() error = %v", err)
+	}
+
+	// Re-registering a provider replaces its profile
+	RegisterProfile(Profile{Provider: "test", Hosts: []string{"push.example.com"}})
+	if got := sub.Provider(); got != ProviderUnknown {
+		t.Errorf("Provider() after re-registering = %q, want %q", got, ProviderUnknown)
+	}
+
+	// Registered hosts match regardless of case
+	RegisterProfile(Profile{Provider: "mixed", Hosts: []string{"*.Push.Example.ORG"}})
+	if got := DetectProvider("https://Updates.push.example.org/abc"); got != "mixed" {
+		t.Errorf("DetectProvider() = %q, want %q", got, "mixed")
+	}
+}
+
+func TestRegisterProfile_EmptyProvider(t *testing.T) {
+	saved := profiles
+	t.Cleanup(func() { profiles = saved })
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterProfile() with empty Provider didn't panic")
+		}
+	}()
+	RegisterProfile(Profile{Hosts: []string{"push.example.com"}})
+}
+
+func TestValidateAppleSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		wantErr bool
+	}{
+		{"mailto:admin@example.com", false},
+		{"https://example.com/contact", false},
+		{"mailto:admin@localhost", true},
+		{"mailto:admin@LocalHost.", true},
+		{"https://localhost", true},
+		{"https://localhost:8080/contact", true},
+		{"https://app.localhost", true},
+		{"https://localhost.example.com", false},
+	}
+	for _, tt := range tests {
+		if err := validateAppleSubject(tt.subject); (err != nil) != tt.wantErr {
+			t.Errorf("validateAppleSubject(%q) error = %v, wantErr %v", tt.subject, err, tt.wantErr)
+		}
+	}
+}
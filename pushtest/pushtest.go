@@ -0,0 +1,381 @@
+// Package pushtest provides a fake push service for testing Web Push senders.
+//
+// The fake implements the RFC 8030 semantics a sender relies on: it
+// authenticates VAPID credentials, validates the TTL, Urgency and Topic
+// headers, stores messages (replacing them by topic), and can be told to fail
+// pushes to particular subscriptions with 404, 410, 413, 429 and so on.
+// Senders may also cancel undelivered messages and request delivery receipts,
+// which are sent when a test calls Server.Acknowledge. Unlike a real push
+// service, the fake POSTs receipts to the Push-Receipt URL as webhooks, in
+// the form webpush.ReceiptHandler accepts.
+package pushtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imjasonh/webpush"
+	"github.com/imjasonh/webpush/receiver"
+	"github.com/imjasonh/webpush/vapid"
+)
+
+// Message is a push message accepted by the fake push service.
+type Message struct {
+	ID         string      // Identifies the message; its URL is Server.URL + "/m/" + ID
+	Endpoint   string      // Subscription endpoint the message was sent to
+	Payload    []byte      // Decrypted payload, if the message used aes128gcm
+	Body       []byte      // Encrypted request body
+	TTL        int         // TTL header value, in seconds
+	Urgency    string      // Urgency header value, if any
+	Topic      string      // Topic header value, if any
+	Receipt    string      // Push-Receipt header value, if any
+	Header     http.Header // All request headers
+	ReceivedAt time.Time
+}
+
+// Failure describes how pushes to a subscription should fail.
+type Failure struct {
+	StatusCode int           // Status code to respond with
+	RetryAfter time.Duration // If set, sent as the Retry-After header
+	Times      int           // Number of pushes to fail; 0 fails every push
+}
+
+// Server is a fake push service.
+type Server struct {
+	*httptest.Server
+
+	// ReceiptClient is used by Acknowledge to deliver receipts. If nil,
+	// http.DefaultClient is used.
+	ReceiptClient *http.Client
+
+	mu       sync.Mutex
+	subs     map[string]*subscription // keyed by endpoint
+	messages map[string]*Message      // keyed by ID
+	nextID   int
+}
+
+type subscription struct {
+	subscriber *receiver.Subscriber
+	appKey     []byte // Restricts pushes to this VAPID key, if set
+	messages   []*Message
+	failure    Failure
+}
+
+// NewServer starts a fake push service over TLS. Use Server.Client to get an
+// HTTP client that trusts it, and Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		subs:     make(map[string]*subscription),
+		messages: make(map[string]*Message),
+	}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Subscribe creates a subscription on the fake push service, as a browser
+// would with PushManager.subscribe(). If applicationServerKey is non-nil,
+// pushes to the subscription must be authenticated with that VAPID key.
+func (s *Server) Subscribe(applicationServerKey []byte) (*webpush.Subscription, error) {
+	subscriber, err := receiver.NewSubscriber()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	endpoint := fmt.Sprintf("%s/push/%d", s.URL, s.nextID)
+	s.subs[endpoint] = &subscription{
+		subscriber: subscriber,
+		appKey:     applicationServerKey,
+	}
+	return subscriber.Subscription(endpoint), nil
+}
+
+// Unsubscribe removes a subscription. Later pushes to it fail with 410 Gone.
+func (s *Server) Unsubscribe(sub *webpush.Subscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ps, ok := s.subs[sub.Endpoint]; ok {
+		for _, msg := range ps.messages {
+			delete(s.messages, msg.ID)
+		}
+		ps.messages = nil
+		ps.failure = Failure{StatusCode: http.StatusGone}
+	}
+}
+
+// Fail makes pushes to sub fail as described by f. Passing the zero Failure
+// clears any failure previously set.
+func (s *Server) Fail(sub *webpush.Subscription, f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ps, ok := s.subs[sub.Endpoint]; ok {
+		ps.failure = f
+	}
+}
+
+// Messages returns the messages stored for sub, oldest first. A message
+// replaced by a newer one with the same topic is no longer returned.
+func (s *Server) Messages(sub *webpush.Subscription) []*Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ps, ok := s.subs[sub.Endpoint]
+	if !ok {
+		return nil
+	}
+	return append([]*Message(nil), ps.messages...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/push/"):
+		s.handlePush(w, r)
+	case strings.HasPrefix(r.URL.Path, "/m/"):
+		s.handleMessage(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handlePush handles a push request to a subscription endpoint.
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	endpoint := s.URL + r.URL.Path
+
+	s.mu.Lock()
+	ps, ok := s.subs[endpoint]
+	if ok && ps.failure.StatusCode != 0 {
+		f := ps.failure
+		if f.Times > 0 {
+			if ps.failure.Times--; ps.failure.Times == 0 {
+				ps.failure = Failure{}
+			}
+		}
+		s.mu.Unlock()
+		if f.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(f.RetryAfter.Seconds())))
+		}
+		http.Error(w, http.StatusText(f.StatusCode), f.StatusCode)
+		return
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if status, err := s.authenticate(r, ps); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	msg, status, err := s.parseMessage(r, endpoint, ps)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	msg.ID = strconv.Itoa(s.nextID)
+	s.store(ps, msg)
+	s.mu.Unlock()
+
+	w.Header().Set("Location", s.URL+"/m/"+msg.ID)
+	w.Header().Set("TTL", strconv.Itoa(msg.TTL))
+	if msg.Receipt != "" && strings.Contains(r.Header.Get("Prefer"), "respond-async") {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleMessage handles a request to a push message resource. The only
+// supported request is DELETE, which cancels an undelivered message.
+func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/m/")
+
+	s.mu.Lock()
+	msg, ok := s.messages[id]
+	var ps *subscription
+	if ok {
+		ps = s.subs[msg.Endpoint]
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if status, err := s.authenticate(r, ps); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	s.mu.Lock()
+	removed := s.remove(msg)
+	s.mu.Unlock()
+	if !removed {
+		// Acknowledged or cancelled concurrently
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authenticate verifies the VAPID credentials of a request concerning ps,
+// returning an error with the status code to respond with.
+func (s *Server) authenticate(r *http.Request, ps *subscription) (int, error) {
+	creds, err := vapid.ParseHeader(r.Header)
+	if err == nil {
+		_, err = creds.Verify(s.URL, time.Now())
+	}
+	if err != nil {
+		return http.StatusUnauthorized, fmt.Errorf("invalid VAPID credentials: %w", err)
+	}
+	if ps.appKey != nil && !bytes.Equal(creds.PublicKey, ps.appKey) {
+		return http.StatusForbidden, errors.New("VAPID key does not match subscription")
+	}
+	return 0, nil
+}
+
+// Acknowledge simulates the user agent acknowledging delivery of msg: the
+// message is removed and, if it was sent with a Push-Receipt header, a
+// delivery receipt is POSTed to the receipt subscription with the message
+// URL in the Content-Location header. It returns an error if msg was already
+// acknowledged or cancelled, or if the receipt was not accepted.
+func (s *Server) Acknowledge(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	removed := s.remove(msg)
+	s.mu.Unlock()
+	if !removed {
+		return fmt.Errorf("message %s not found", msg.ID)
+	}
+	if msg.Receipt == "" {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.Receipt, nil)
+	if err != nil {
+		return fmt.Errorf("creating receipt request: %w", err)
+	}
+	req.Header.Set("Content-Location", s.URL+"/m/"+msg.ID)
+
+	client := s.ReceiptClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending receipt: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receipt subscription returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// parseMessage validates a push request, returning the message or an error
+// with the status code to respond with.
+func (s *Server) parseMessage(r *http.Request, endpoint string, ps *subscription) (*Message, int, error) {
+	msg := &Message{
+		Endpoint:   endpoint,
+		Urgency:    r.Header.Get("Urgency"),
+		Topic:      r.Header.Get("Topic"),
+		Receipt:    r.Header.Get("Push-Receipt"),
+		Header:     r.Header.Clone(),
+		ReceivedAt: time.Now(),
+	}
+
+	ttl, err := strconv.Atoi(r.Header.Get("TTL"))
+	if err != nil || ttl < 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid TTL header %q", r.Header.Get("TTL"))
+	}
+	msg.TTL = ttl
+
+	switch msg.Urgency {
+	case "", "very-low", "low", "normal", "high":
+	default:
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid Urgency header %q", msg.Urgency)
+	}
+
+	if _, ok := r.Header["Topic"]; ok && !webpush.ValidTopic(msg.Topic) {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid Topic header %q", msg.Topic)
+	}
+
+	msg.Body, err = io.ReadAll(io.LimitReader(r.Body, webpush.MaxRecordSize+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("reading body: %w", err)
+	}
+	if len(msg.Body) > webpush.MaxRecordSize {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("payload too large")
+	}
+
+	switch enc := r.Header.Get("Content-Encoding"); enc {
+	case string(webpush.AES128GCM):
+		msg.Payload, err = ps.subscriber.Decrypt(msg.Body)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("decrypting payload: %w", err)
+		}
+	case string(webpush.AESGCM):
+		if r.Header.Get("Encryption") == "" || r.Header.Get("Crypto-Key") == "" {
+			return nil, http.StatusBadRequest, errors.New("aesgcm requires Encryption and Crypto-Key headers")
+		}
+	default:
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported Content-Encoding %q", enc)
+	}
+
+	return msg, 0, nil
+}
+
+// store saves msg for ps, replacing any stored message with the same topic.
+// s.mu must be held.
+func (s *Server) store(ps *subscription, msg *Message) {
+	s.messages[msg.ID] = msg
+	if msg.Topic != "" {
+		for i, old := range ps.messages {
+			if old.Topic == msg.Topic {
+				delete(s.messages, old.ID)
+				ps.messages = append(ps.messages[:i], ps.messages[i+1:]...)
+				break
+			}
+		}
+	}
+	ps.messages = append(ps.messages, msg)
+}
+
+// remove deletes a stored message, reporting whether it was still stored.
+// s.mu must be held.
+func (s *Server) remove(msg *Message) bool {
+	if _, ok := s.messages[msg.ID]; !ok {
+		return false
+	}
+	delete(s.messages, msg.ID)
+	if ps, ok := s.subs[msg.Endpoint]; ok {
+		for i, m := range ps.messages {
+			if m.ID == msg.ID {
+				ps.messages = append(ps.messages[:i], ps.messages[i+1:]...)
+				break
+			}
+		}
+	}
+	return true
+}
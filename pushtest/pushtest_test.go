@@ -0,0 +1,326 @@
+package pushtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imjasonh/webpush"
+	"github.com/imjasonh/webpush/keys"
+)
+
+func newTestClient(t *testing.T, server *Server, opts ...webpush.ClientOption) (*webpush.Client, *keys.FileSigner) {
+	t.Helper()
+	privateKeyB64, _, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+	signer, err := keys.NewFileSignerFromBase64(privateKeyB64)
+	if err != nil {
+		t.Fatalf("NewFileSignerFromBase64() error = %v", err)
+	}
+	opts = append([]webpush.ClientOption{webpush.WithHTTPClient(server.Client())}, opts...)
+	client, err := webpush.NewClient(signer, "mailto:test@example.com", opts...)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client, signer
+}
+
+func TestServer_Send(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, signer := newTestClient(t, server)
+
+	sub, err := server.Subscribe(signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	result, err := client.SendWithResult(context.Background(), sub, []byte("hello"), &webpush.Options{
+		TTL:     time.Minute,
+		Urgency: webpush.High,
+	})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+
+	msgs := server.Messages(sub)
+	if len(msgs) != 1 {
+		t.Fatalf("Messages() = %d messages, want 1", len(msgs))
+	}
+	msg := msgs[0]
+	if !bytes.Equal(msg.Payload, []byte("hello")) {
+		t.Errorf("Payload = %q, want %q", msg.Payload, "hello")
+	}
+	if msg.TTL != 60 || msg.Urgency != "high" {
+		t.Errorf("TTL, Urgency = %d, %q, want 60, high", msg.TTL, msg.Urgency)
+	}
+	if want := server.URL + "/m/" + msg.ID; result.MessageURL != want {
+		t.Errorf("MessageURL = %q, want %q", result.MessageURL, want)
+	}
+}
+
+func TestServer_LegacyVAPID(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, signer := newTestClient(t, server)
+
+	sub, err := server.Subscribe(signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	// aesgcm messages use the legacy WebPush Authorization scheme by default.
+	if err := client.Send(context.Background(), sub, []byte("hello"), &webpush.Options{ContentEncoding: webpush.AESGCM}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	msgs := server.Messages(sub)
+	if len(msgs) != 1 {
+		t.Fatalf("Messages() = %d messages, want 1", len(msgs))
+	}
+	if auth := msgs[0].Header.Get("Authorization"); !strings.HasPrefix(auth, "WebPush ") {
+		t.Errorf("Authorization = %q, want WebPush scheme", auth)
+	}
+}
+
+func TestServer_TopicReplacement(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, _ := newTestClient(t, server)
+
+	sub, err := server.Subscribe(nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	for _, send := range []struct{ payload, topic string }{
+		{"score 1-0", "score"},
+		{"unrelated", ""},
+		{"score 2-0", "score"},
+	} {
+		if err := client.Send(context.Background(), sub, []byte(send.payload), &webpush.Options{Topic: send.topic}); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	var got []string
+	for _, msg := range server.Messages(sub) {
+		got = append(got, string(msg.Payload))
+	}
+	if want := "unrelated,score 2-0"; strings.Join(got, ",") != want {
+		t.Errorf("Messages() = %q, want %q", got, want)
+	}
+}
+
+func TestServer_Failures(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, _ := newTestClient(t, server)
+
+	tests := []struct {
+		name    string
+		failure Failure
+		check   func(error) bool
+	}{
+		{"not found", Failure{StatusCode: http.StatusNotFound}, webpush.IsNotFound},
+		{"gone", Failure{StatusCode: http.StatusGone}, webpush.IsGone},
+		{"too large", Failure{StatusCode: http.StatusRequestEntityTooLarge}, webpush.IsPayloadTooLarge},
+		{"rate limited", Failure{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Minute}, webpush.IsRateLimited},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, err := server.Subscribe(nil)
+			if err != nil {
+				t.Fatalf("Subscribe() error = %v", err)
+			}
+			server.Fail(sub, tt.failure)
+
+			err = client.Send(context.Background(), sub, []byte("hello"), nil)
+			if !tt.check(err) {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if len(server.Messages(sub)) != 0 {
+				t.Error("failed push was stored")
+			}
+		})
+	}
+}
+
+func TestServer_FailTimes(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, _ := newTestClient(t, server, webpush.WithRetryPolicy(webpush.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	sub, err := server.Subscribe(nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	server.Fail(sub, Failure{StatusCode: http.StatusServiceUnavailable, Times: 2})
+
+	result, err := client.SendWithResult(context.Background(), sub, []byte("hello"), nil)
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if result.Attempts != 3 {
+		t.Errorf("Attempts = %d, want 3", result.Attempts)
+	}
+}
+
+func TestServer_Unsubscribe(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, _ := newTestClient(t, server)
+
+	sub, err := server.Subscribe(nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	server.Unsubscribe(sub)
+
+	if err := client.Send(context.Background(), sub, []byte("hello"), nil); !webpush.IsGone(err) {
+		t.Errorf("Send() error = %v, want 410 Gone", err)
+	}
+}
+
+func TestServer_RejectsWrongKey(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, _ := newTestClient(t, server)
+	_, otherSigner := newTestClient(t, server)
+
+	sub, err := server.Subscribe(otherSigner.PublicKey())
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	err = client.Send(context.Background(), sub, []byte("hello"), nil)
+	if !webpush.IsAuthError(err) {
+		t.Errorf("Send() error = %v, want auth error", err)
+	}
+}
+
+// headerTransport overrides request headers, to send requests the
+// webpush.Client itself would refuse to.
+type headerTransport struct {
+	base   http.RoundTripper
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	for k, v := range t.header {
+		r.Header[k] = v
+	}
+	return t.base.RoundTrip(r)
+}
+
+func TestServer_ValidatesRequests(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	sub, err := server.Subscribe(nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header http.Header
+	}{
+		{"bad urgency", http.Header{"Urgency": {"urgent"}}},
+		{"topic too long", http.Header{"Topic": {strings.Repeat("a", 33)}}},
+		{"topic with invalid characters", http.Header{"Topic": {"no spaces"}}},
+		{"bad TTL", http.Header{"Ttl": {"soon"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, server, webpush.WithHTTPClient(&http.Client{
+				Transport: &headerTransport{base: server.Client().Transport, header: tt.header},
+			}))
+
+			err := client.Send(context.Background(), sub, []byte("hello"), nil)
+			var pe *webpush.PushError
+			if !errors.As(err, &pe) || pe.StatusCode != http.StatusBadRequest {
+				t.Errorf("Send() error = %v, want 400", err)
+			}
+		})
+	}
+}
+
+func TestServer_Cancel(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, signer := newTestClient(t, server)
+
+	sub, err := server.Subscribe(signer.PublicKey())
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	result, err := client.SendWithResult(context.Background(), sub, []byte("your ride is arriving"), nil)
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if err := client.Cancel(context.Background(), result.MessageURL); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if msgs := server.Messages(sub); len(msgs) != 0 {
+		t.Errorf("Messages() = %d messages after Cancel, want 0", len(msgs))
+	}
+
+	if err := client.Cancel(context.Background(), result.MessageURL); !webpush.IsNotFound(err) {
+		t.Errorf("second Cancel() error = %v, want IsNotFound", err)
+	}
+}
+
+func TestServer_Receipts(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, _ := newTestClient(t, server)
+
+	receipts := make(chan *webpush.Receipt, 1)
+	receiptServer := httptest.NewServer(webpush.ReceiptHandler(nil, func(r *webpush.Receipt) {
+		receipts <- r
+	}))
+	defer receiptServer.Close()
+
+	sub, err := server.Subscribe(nil)
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	result, err := client.SendWithResult(context.Background(), sub, []byte("hello"), &webpush.Options{
+		ReceiptSubscription: receiptServer.URL + "/receipts/1",
+	})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if result.StatusCode != http.StatusAccepted {
+		t.Errorf("StatusCode = %d, want %d", result.StatusCode, http.StatusAccepted)
+	}
+
+	msgs := server.Messages(sub)
+	if len(msgs) != 1 {
+		t.Fatalf("Messages() = %d messages, want 1", len(msgs))
+	}
+	if err := server.Acknowledge(context.Background(), msgs[0]); err != nil {
+		t.Fatalf("Acknowledge() error = %v", err)
+	}
+
+	receipt := <-receipts
+	if receipt.MessageURL != result.MessageURL {
+		t.Errorf("Receipt.MessageURL = %q, want %q", receipt.MessageURL, result.MessageURL)
+	}
+	if err := client.Cancel(context.Background(), result.MessageURL); !webpush.IsNotFound(err) {
+		t.Errorf("Cancel() after Acknowledge error = %v, want IsNotFound", err)
+	}
+}
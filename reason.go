@@ -0,0 +1,120 @@
+package webpush
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Reason classifies why a push service rejected a message, combining the
+// provider-specific error code with the status code.
+type Reason string
+
+// Reasons a push service may reject a message.
+const (
+	ReasonUnknown             Reason = ""
+	ReasonUnsubscribed        Reason = "unsubscribed"         // The user unsubscribed or revoked permission
+	ReasonExpiredSubscription Reason = "expired-subscription" // The subscription expired
+	ReasonInvalidSubscription Reason = "invalid-subscription" // The endpoint or keys were never valid
+	ReasonBadJWT              Reason = "bad-jwt"              // The VAPID credentials were rejected
+	ReasonPayloadTooLarge     Reason = "payload-too-large"    // The encrypted payload was too large
+	ReasonTooManyRequests     Reason = "too-many-requests"    // The sender is being rate limited
+	ReasonBadRequest          Reason = "bad-request"          // Some other part of the request was invalid
+	ReasonServerError         Reason = "server-error"         // The push service failed
+	ReasonMessageNotFound     Reason = "message-not-found"    // Client.Cancel: the message was already delivered or expired
+)
+
+// SubscriptionGone reports whether the reason means the subscription can
+// never be used again and should be deleted.
+func (r Reason) SubscriptionGone() bool {
+	switch r {
+	case ReasonUnsubscribed, ReasonExpiredSubscription, ReasonInvalidSubscription:
+		return true
+	}
+	return false
+}
+
+// ReasonOf returns the Reason for an error returned by Client.Send or
+// Client.Cancel, or
+// ReasonUnknown if err doesn't come from a rejected message.
+func ReasonOf(err error) Reason {
+	var pe *PushError
+	if errors.As(err, &pe) {
+		return pe.Reason
+	}
+	if errors.Is(err, ErrPayloadTooLarge) {
+		return ReasonPayloadTooLarge
+	}
+	return ReasonUnknown
+}
+
+// statusReason returns the Reason implied by a status code alone.
+func statusReason(status int) Reason {
+	switch status {
+	case http.StatusGone:
+		return ReasonUnsubscribed
+	case http.StatusNotFound:
+		return ReasonExpiredSubscription
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ReasonBadJWT
+	case http.StatusRequestEntityTooLarge:
+		return ReasonPayloadTooLarge
+	case http.StatusTooManyRequests:
+		return ReasonTooManyRequests
+	case http.StatusBadRequest:
+		return ReasonBadRequest
+	}
+	if status >= 500 {
+		return ReasonServerError
+	}
+	return ReasonUnknown
+}
+
+// mozillaReasons maps autopush errno values to reasons.
+var mozillaReasons = map[string]Reason{
+	"102": ReasonInvalidSubscription, // Invalid URL endpoint
+	"103": ReasonExpiredSubscription, // Expired URL endpoint
+	"104": ReasonPayloadTooLarge,     // Data payload too large
+	"105": ReasonUnsubscribed,        // Endpoint became unavailable during request
+	"106": ReasonUnsubscribed,        // Invalid subscription
+	"109": ReasonBadJWT,              // Invalid authentication
+	"110": ReasonBadRequest,          // Invalid crypto keys specified
+	"111": ReasonBadRequest,          // Missing required header
+	"112": ReasonBadRequest,          // Invalid TTL header value
+	"114": ReasonBadRequest,          // Invalid Topic
+}
+
+// appleReasons maps APNs reason strings to reasons.
+var appleReasons = map[string]Reason{
+	"BadDeviceToken":              ReasonInvalidSubscription,
+	"DeviceTokenNotForTopic":      ReasonInvalidSubscription,
+	"Unregistered":                ReasonUnsubscribed,
+	"ExpiredToken":                ReasonExpiredSubscription,
+	"BadJwtToken":                 ReasonBadJWT,
+	"ExpiredProviderToken":        ReasonBadJWT,
+	"InvalidProviderToken":        ReasonBadJWT,
+	"MissingProviderToken":        ReasonBadJWT,
+	"PayloadTooLarge":             ReasonPayloadTooLarge,
+	"TooManyRequests":             ReasonTooManyRequests,
+	"TooManyProviderTokenUpdates": ReasonTooManyRequests,
+	"BadExpirationDate":           ReasonBadRequest,
+	"BadPriority":                 ReasonBadRequest,
+	"BadTopic":                    ReasonBadRequest,
+	"InternalServerError":         ReasonServerError,
+	"ServiceUnavailable":          ReasonServerError,
+	"Shutdown":                    ReasonServerError,
+}
+
+// fcmReasons maps FCM error codes and Google API statuses to reasons.
+var fcmReasons = map[string]Reason{
+	"UNREGISTERED":           ReasonUnsubscribed,
+	"NOT_FOUND":              ReasonExpiredSubscription,
+	"SENDER_ID_MISMATCH":     ReasonBadJWT,
+	"THIRD_PARTY_AUTH_ERROR": ReasonBadJWT,
+	"UNAUTHENTICATED":        ReasonBadJWT,
+	"PERMISSION_DENIED":      ReasonBadJWT,
+	"QUOTA_EXCEEDED":         ReasonTooManyRequests,
+	"RESOURCE_EXHAUSTED":     ReasonTooManyRequests,
+	"INVALID_ARGUMENT":       ReasonBadRequest,
+	"UNAVAILABLE":            ReasonServerError,
+	"INTERNAL":               ReasonServerError,
+}
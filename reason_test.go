@@ -0,0 +1,52 @@
+package webpush
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestReasonOf(t *testing.T) {
+	pushError := func(status int, endpoint, body string) error {
+		resp := &http.Response{StatusCode: status, Header: http.Header{}}
+		return fmt.Errorf("wrapped: %w", newPushError(resp, []byte(body), endpoint))
+	}
+	const mozilla = "https://updates.push.services.mozilla.com/wpush/v2/abc"
+	const apple = "https://web.push.apple.com/abc"
+
+	tests := []struct {
+		name     string
+		err      error
+		want     Reason
+		wantGone bool
+	}{
+		{"nil", nil, ReasonUnknown, false},
+		{"other error", errors.New("connection reset"), ReasonUnknown, false},
+		{"payload too large before sending", &PayloadTooLargeError{Size: 5000, Max: 4096}, ReasonPayloadTooLarge, false},
+		{"410", pushError(http.StatusGone, "https://push.example.com/abc", ""), ReasonUnsubscribed, true},
+		{"404", pushError(http.StatusNotFound, "https://push.example.com/abc", ""), ReasonExpiredSubscription, true},
+		{"403", pushError(http.StatusForbidden, "https://push.example.com/abc", ""), ReasonBadJWT, false},
+		{"429", pushError(http.StatusTooManyRequests, "https://push.example.com/abc", ""), ReasonTooManyRequests, false},
+		{"503", pushError(http.StatusServiceUnavailable, "https://push.example.com/abc", ""), ReasonServerError, false},
+		{"mozilla expired", pushError(http.StatusGone, mozilla, `{"code": 410, "errno": 103}`), ReasonExpiredSubscription, true},
+		{"mozilla invalid endpoint", pushError(http.StatusNotFound, mozilla, `{"code": 404, "errno": 102}`), ReasonInvalidSubscription, true},
+		{"mozilla payload", pushError(http.StatusRequestEntityTooLarge, mozilla, `{"code": 413, "errno": 104}`), ReasonPayloadTooLarge, false},
+		{"mozilla auth", pushError(http.StatusUnauthorized, mozilla, `{"code": 401, "errno": 109}`), ReasonBadJWT, false},
+		{"apple unregistered", pushError(http.StatusGone, apple, `{"reason": "Unregistered"}`), ReasonUnsubscribed, true},
+		{"apple bad token", pushError(http.StatusBadRequest, apple, `{"reason": "BadDeviceToken"}`), ReasonInvalidSubscription, true},
+		{"apple rate limited", pushError(http.StatusTooManyRequests, apple, `{"reason": "TooManyProviderTokenUpdates"}`), ReasonTooManyRequests, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ReasonOf(tt.err)
+			if got != tt.want {
+				t.Errorf("ReasonOf() = %q, want %q", got, tt.want)
+			}
+			if got.SubscriptionGone() != tt.wantGone {
+				t.Errorf("SubscriptionGone() = %v, want %v", got.SubscriptionGone(), tt.wantGone)
+			}
+		})
+	}
+}
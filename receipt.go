@@ -0,0 +1,155 @@
+package webpush
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+)
+
+// Cancel deletes a push message that hasn't been delivered yet, such as a
+// notification that is no longer relevant (RFC 8030 section 7.1). messageURL
+// is the SendResult.MessageURL returned when the message was sent.
+//
+// If the message has already been delivered or has expired, Cancel returns a
+// *PushError matching ErrMessageNotFound with errors.Is. Its Reason is
+// ReasonMessageNotFound, never one that says the subscription is gone.
+func (c *Client) Cancel(ctx context.Context, messageURL string) error {
+	if messageURL == "" {
+		return errors.New("message URL is required")
+	}
+
+	// The message URL's origin is the VAPID audience, as for the endpoint
+	header := make(http.Header)
+	if err := c.setVAPIDHeaders(ctx, header, messageURL, ""); err != nil {
+		return fmt.Errorf("creating VAPID header: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.delete(ctx, messageURL, header)
+		if err == nil {
+			return nil
+		}
+
+		delay, retry := c.retryPolicy.next(ctx, attempt, err)
+		if !retry {
+			return err
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return fmt.Errorf("waiting to retry: %w", err)
+		}
+	}
+}
+
+// delete makes a single attempt to delete a push message resource.
+func (c *Client) delete(ctx context.Context, messageURL string, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, messageURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header = header.Clone()
+
+	resp, err := c.do(req)
+	if err != nil {
+		return fmt.Errorf("sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return newMessageError(resp, respBody, messageURL)
+	}
+	return nil
+}
+
+// newMessageError builds a PushError for a failed request on a push message
+// resource. Responses that would mean a subscription is gone instead mean
+// the message is, so callers never delete a subscription because a
+// cancellation came too late.
+func newMessageError(resp *http.Response, body []byte, messageURL string) *PushError {
+	pe := newPushError(resp, body, messageURL)
+	pe.Endpoint = ""
+	if pe.Reason.SubscriptionGone() || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		pe.Reason = ReasonMessageNotFound
+	}
+	return pe
+}
+
+// Receipt is a delivery receipt for a push message sent with
+// Options.ReceiptSubscription.
+type Receipt struct {
+	MessageURL string // Push message resource, as in SendResult.MessageURL
+	MessageID  string // Last path segment of MessageURL
+	ReceivedAt time.Time
+}
+
+// ReceiptHandler returns an http.Handler that receives delivery receipts as
+// webhooks. It calls fn with each receipt and then responds 204 No Content.
+//
+// This is not how RFC 8030 delivers receipts: there, the application server
+// creates a receipt subscription at the push service and receives receipts
+// over HTTP/2 server push, and no push service POSTs to a handler like this.
+// It is for internal relays that forward receipts as webhooks, and for
+// pushtest.Server, which POSTs receipts when a test acknowledges a message.
+//
+// Each receipt is a POST request whose Content-Location header is the URL of
+// the acknowledged push message, which matches the MessageURL returned when
+// it was sent.
+//
+// Anyone who can reach the handler can report a message as delivered, so
+// verify must authenticate each request, for example with
+// VerifyBearerToken. Requests it rejects get 401 Unauthorized and fn isn't
+// called. Pass a nil verify only if the handler is reachable by trusted
+// senders alone, such as in tests.
+func ReceiptHandler(verify func(*http.Request) error, fn func(*Receipt)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if verify != nil {
+			if err := verify(r); err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		loc, err := url.Parse(r.Header.Get("Content-Location"))
+		if err != nil || !loc.IsAbs() {
+			http.Error(w, "Missing or invalid Content-Location header", http.StatusBadRequest)
+			return
+		}
+
+		fn(&Receipt{
+			MessageURL: loc.String(),
+			MessageID:  messageID(loc),
+			ReceivedAt: time.Now(),
+		})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// VerifyBearerToken returns a ReceiptHandler verify function that accepts
+// requests with the header "Authorization: Bearer <token>".
+func VerifyBearerToken(token string) func(*http.Request) error {
+	want := []byte("Bearer " + token)
+	return func(r *http.Request) error {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			return errors.New("missing or invalid bearer token")
+		}
+		return nil
+	}
+}
+
+// messageID returns the last path segment of a push message URL, or "" if
+// there isn't one.
+func messageID(u *url.URL) string {
+	if id := path.Base(u.Path); id != "." && id != "/" {
+		return id
+	}
+	return ""
+}
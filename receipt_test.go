@@ -0,0 +1,140 @@
+package webpush
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClient_Cancel(t *testing.T) {
+	var method, auth string
+	status := http.StatusNoContent
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, auth = r.Method, r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com", WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	if err := client.Cancel(context.Background(), server.URL+"/m/msg-42"); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if method != http.MethodDelete {
+		t.Errorf("method = %s, want DELETE", method)
+	}
+	if !strings.HasPrefix(auth, "vapid t=") {
+		t.Errorf("Authorization = %q, want vapid scheme", auth)
+	}
+
+	// The message was already delivered; the subscription is unaffected
+	for _, status = range []int{http.StatusNotFound, http.StatusGone} {
+		err := client.Cancel(context.Background(), server.URL+"/m/msg-42")
+		if !errors.Is(err, ErrMessageNotFound) {
+			t.Errorf("Cancel() error = %v, want ErrMessageNotFound", err)
+		}
+		if ReasonOf(err).SubscriptionGone() {
+			t.Errorf("ReasonOf(Cancel() error) = %q, want a reason that keeps the subscription", ReasonOf(err))
+		}
+	}
+
+	// FCM's NOT_FOUND code means the message is gone, too
+	saved := profiles
+	t.Cleanup(func() { profiles = saved })
+	RegisterProfile(Profile{Provider: ProviderFCM, Hosts: []string{"127.0.0.1"}, ParseError: parseFCMError, Reasons: fcmReasons})
+	status = http.StatusNotFound
+	err = client.Cancel(context.Background(), server.URL+"/m/msg-42")
+	if got := ReasonOf(err); got != ReasonMessageNotFound {
+		t.Errorf("ReasonOf(Cancel() error) = %q, want %q", got, ReasonMessageNotFound)
+	}
+}
+
+func TestClient_SendReceiptSubscription(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.Header().Set("Location", "/m/msg-42")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc123")
+	client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com", WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	receiptURL := "https://example.com/receipts/1"
+	result, err := client.SendWithResult(context.Background(), sub, []byte("test"), &Options{ReceiptSubscription: receiptURL})
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if result.StatusCode != http.StatusAccepted {
+		t.Errorf("StatusCode = %d, want %d", result.StatusCode, http.StatusAccepted)
+	}
+
+	h := <-headers
+	if got := h.Get("Push-Receipt"); got != receiptURL {
+		t.Errorf("Push-Receipt = %q, want %q", got, receiptURL)
+	}
+	if got := h.Get("Prefer"); got != "respond-async" {
+		t.Errorf("Prefer = %q, want respond-async", got)
+	}
+}
+
+func TestReceiptHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		location   string
+		auth       string
+		wantStatus int
+		wantID     string
+	}{
+		{"receipt", http.MethodPost, "https://push.example.com/m/msg-42", "Bearer secret", http.StatusNoContent, "msg-42"},
+		{"wrong method", http.MethodGet, "https://push.example.com/m/msg-42", "Bearer secret", http.StatusMethodNotAllowed, ""},
+		{"missing location", http.MethodPost, "", "Bearer secret", http.StatusBadRequest, ""},
+		{"relative location", http.MethodPost, "/m/msg-42", "Bearer secret", http.StatusBadRequest, ""},
+		{"missing token", http.MethodPost, "https://push.example.com/m/msg-42", "", http.StatusUnauthorized, ""},
+		{"wrong token", http.MethodPost, "https://push.example.com/m/msg-42", "Bearer guess", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Receipt
+			h := ReceiptHandler(VerifyBearerToken("secret"), func(r *Receipt) { got = r })
+
+			req := httptest.NewRequest(tt.method, "/receipts/1", nil)
+			if tt.location != "" {
+				req.Header.Set("Content-Location", tt.location)
+			}
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantID == "" {
+				if got != nil {
+					t.Errorf("handler called with %+v, want no call", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("handler not called")
+			}
+			if got.MessageURL != tt.location || got.MessageID != tt.wantID {
+				t.Errorf("Receipt = %q, %q, want %q, %q", got.MessageURL, got.MessageID, tt.location, tt.wantID)
+			}
+		})
+	}
+}
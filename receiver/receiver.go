@@ -0,0 +1,131 @@
+// Package receiver implements the subscriber side of Web Push, standing in
+// for a browser. It generates subscription key material, serves as a push
+// endpoint, and decrypts incoming messages.
+//
+// It is useful for exercising webpush.Client end to end in tests, and for
+// receiving push messages on headless devices.
+package receiver
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/imjasonh/webpush"
+)
+
+const messageBuffer = 16
+
+// Message is a decrypted push message.
+type Message struct {
+	Payload    []byte      // Decrypted payload
+	Header     http.Header // Request headers, including TTL, Urgency and Topic
+	ReceivedAt time.Time
+}
+
+// Subscriber holds the key material for a push subscription and receives
+// messages sent to it.
+type Subscriber struct {
+	privateKey *ecdh.PrivateKey
+	authSecret []byte
+	messages   chan *Message
+}
+
+// NewSubscriber creates a subscriber with a new P-256 key pair and
+// authentication secret.
+func NewSubscriber() (*Subscriber, error) {
+	privateKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	authSecret := make([]byte, 16)
+	if _, err := rand.Read(authSecret); err != nil {
+		return nil, fmt.Errorf("generating auth secret: %w", err)
+	}
+
+	return &Subscriber{
+		privateKey: privateKey,
+		authSecret: authSecret,
+		messages:   make(chan *Message, messageBuffer),
+	}, nil
+}
+
+// Subscription returns a subscription for the given push endpoint, as a
+// browser would report from PushManager.subscribe().
+func (s *Subscriber) Subscription(endpoint string) *webpush.Subscription {
+	return &webpush.Subscription{
+		Endpoint: endpoint,
+		Keys: webpush.Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(s.privateKey.PublicKey().Bytes()),
+			Auth:   base64.RawURLEncoding.EncodeToString(s.authSecret),
+		},
+	}
+}
+
+// PrivateKey returns the subscriber's private key.
+func (s *Subscriber) PrivateKey() *ecdh.PrivateKey {
+	return s.privateKey
+}
+
+// AuthSecret returns the subscriber's authentication secret.
+func (s *Subscriber) AuthSecret() []byte {
+	return s.authSecret
+}
+
+// Decrypt decrypts an aes128gcm message body sent to this subscriber.
+func (s *Subscriber) Decrypt(body []byte) ([]byte, error) {
+	return webpush.Decrypt(s.privateKey, s.authSecret, body)
+}
+
+// Messages returns the channel on which received messages are delivered.
+func (s *Subscriber) Messages() <-chan *Message {
+	return s.messages
+}
+
+// ServeHTTP acts as the subscriber's push endpoint. It decrypts each message
+// and delivers it on the Messages channel, responding 201 Created once the
+// message has been queued. If the channel is full, the request blocks until
+// there is room or the client gives up.
+func (s *Subscriber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if enc := r.Header.Get("Content-Encoding"); enc != string(webpush.AES128GCM) {
+		http.Error(w, "Unsupported content encoding: "+enc, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, webpush.MaxRecordSize+1))
+	if err != nil {
+		http.Error(w, "Failed to read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > webpush.MaxRecordSize {
+		http.Error(w, "Payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	payload, err := s.Decrypt(body)
+	if err != nil {
+		http.Error(w, "Failed to decrypt message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg := &Message{
+		Payload:    payload,
+		Header:     r.Header.Clone(),
+		ReceivedAt: time.Now(),
+	}
+	select {
+	case s.messages <- msg:
+		w.WriteHeader(http.StatusCreated)
+	case <-r.Context().Done():
+		http.Error(w, "Subscriber is not accepting messages", http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,127 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imjasonh/webpush"
+	"github.com/imjasonh/webpush/keys"
+)
+
+func newTestClient(t *testing.T, server *httptest.Server) *webpush.Client {
+	t.Helper()
+	privateKeyB64, _, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error = %v", err)
+	}
+	signer, err := keys.NewFileSignerFromBase64(privateKeyB64)
+	if err != nil {
+		t.Fatalf("NewFileSignerFromBase64() error = %v", err)
+	}
+	client, err := webpush.NewClient(signer, "mailto:test@example.com", webpush.WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestSubscriber_EndToEnd(t *testing.T) {
+	sub, err := NewSubscriber()
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	server := httptest.NewTLSServer(sub)
+	defer server.Close()
+
+	client := newTestClient(t, server)
+	err = client.Send(context.Background(), sub.Subscription(server.URL+"/push"), []byte(`{"title":"Hello"}`), &webpush.Options{
+		TTL:     time.Minute,
+		Topic:   "greeting",
+		Padding: webpush.PadToMultiple(128),
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	select {
+	case msg := <-sub.Messages():
+		if want := []byte(`{"title":"Hello"}`); !bytes.Equal(msg.Payload, want) {
+			t.Errorf("Payload = %q, want %q", msg.Payload, want)
+		}
+		if got := msg.Header.Get("Topic"); got != "greeting" {
+			t.Errorf("Topic = %q, want %q", got, "greeting")
+		}
+		if got := msg.Header.Get("TTL"); got != "60" {
+			t.Errorf("TTL = %q, want %q", got, "60")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func TestSubscriber_Rejects(t *testing.T) {
+	sub, err := NewSubscriber()
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	server := httptest.NewTLSServer(sub)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		encoding string
+		body     []byte
+		want     int
+	}{
+		{"wrong method", http.MethodGet, "aes128gcm", nil, http.StatusMethodNotAllowed},
+		{"legacy encoding", http.MethodPost, "aesgcm", []byte("x"), http.StatusUnsupportedMediaType},
+		{"undecryptable", http.MethodPost, "aes128gcm", bytes.Repeat([]byte{1}, 200), http.StatusBadRequest},
+		{"too large", http.MethodPost, "aes128gcm", make([]byte, 5000), http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, server.URL, bytes.NewReader(tt.body))
+			req.Header.Set("Content-Encoding", tt.encoding)
+			resp, err := server.Client().Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+
+	select {
+	case msg := <-sub.Messages():
+		t.Errorf("unexpected message %q", msg.Payload)
+	default:
+	}
+}
+
+func TestSubscriber_Subscription(t *testing.T) {
+	sub, err := NewSubscriber()
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+
+	data := []byte(`{"endpoint":"https://push.example.com/abc","keys":{"p256dh":"` +
+		sub.Subscription("").Keys.P256dh + `","auth":"` + sub.Subscription("").Keys.Auth + `"}}`)
+	parsed, err := webpush.ParseSubscription(data)
+	if err != nil {
+		t.Fatalf("ParseSubscription() error = %v", err)
+	}
+	if parsed.Endpoint != "https://push.example.com/abc" {
+		t.Errorf("Endpoint = %q", parsed.Endpoint)
+	}
+	if len(sub.AuthSecret()) != 16 {
+		t.Errorf("AuthSecret() length = %d, want 16", len(sub.AuthSecret()))
+	}
+}
@@ -0,0 +1,153 @@
+package webpush
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RetryPolicy configures how Client retries sends that fail with a transient
+// error: a network error, 429 Too Many Requests, or a 5xx response indicating
+// the push service is temporarily unavailable. Other failures, such as
+// 400 Bad Request, 404 Not Found, 410 Gone, or 413 Request Entity Too Large,
+// are never retried because sending the same message again won't succeed.
+//
+// The zero value disables retries.
+type RetryPolicy struct {
+	MaxAttempts    int           // Total attempts, including the first; values <= 1 disable retries
+	InitialBackoff time.Duration // Delay before the first retry
+	MaxBackoff     time.Duration // Upper bound on the delay between attempts (0 = no limit)
+	Multiplier     float64       // Factor the delay grows by after each retry (default 2)
+	Jitter         float64       // Fraction of each delay that is randomized, from 0 to 1
+	MaxRetryAfter  time.Duration // Give up if Retry-After asks to wait longer than this (0 = no limit)
+}
+
+// DefaultRetryPolicy returns a retry policy suitable for most senders: up to
+// three attempts, starting at 500ms and backing off exponentially with jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		MaxRetryAfter:  time.Minute,
+	}
+}
+
+// next reports whether a send that failed with err on the given attempt
+// should be retried, and how long to wait before doing so.
+func (p RetryPolicy) next(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || ctx.Err() != nil || !isRetryable(err) {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+
+	var pe *PushError
+	if errors.As(err, &pe) && pe.RetryAfter > 0 {
+		if p.MaxRetryAfter > 0 && pe.RetryAfter > p.MaxRetryAfter {
+			return 0, false
+		}
+		delay = max(delay, pe.RetryAfter)
+	}
+
+	// Don't wait past the context's deadline only to fail anyway.
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return 0, false
+	}
+	return delay, true
+}
+
+// backoff returns the exponential backoff delay after the given attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// isRetryable reports whether err is a transient failure worth retrying.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pe *PushError
+	if !errors.As(err, &pe) {
+		return isTransportError(err)
+	}
+	switch pe.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isTransportError reports whether err is a network failure that may succeed
+// on another attempt. Invalid endpoints, which fail before a request is
+// sent, and TLS certificate and handshake failures, which recur on every
+// attempt, are not.
+func isTransportError(err error) bool {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || urlErr.Op == "parse" {
+		return false
+	}
+
+	var (
+		certErr     *tls.CertificateVerificationError
+		alertErr    tls.AlertError
+		recordErr   tls.RecordHeaderError
+		unknownCA   x509.UnknownAuthorityError
+		hostnameErr x509.HostnameError
+		invalidErr  x509.CertificateInvalidError
+	)
+	if errors.As(err, &certErr) || errors.As(err, &alertErr) || errors.As(err, &recordErr) ||
+		errors.As(err, &unknownCA) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+
+	// Connection failures and timeouts, or the connection closing before a
+	// response arrived.
+	var netErr net.Error
+	return errors.As(urlErr.Err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
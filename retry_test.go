@@ -0,0 +1,236 @@
+package webpush
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newRetryTestClient returns a client and subscription for a test push
+// server that responds with the given status codes in order, then 201.
+func newRetryTestClient(t *testing.T, policy RetryPolicy, header http.Header, statuses ...int) (*Client, *Subscription, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	t.Cleanup(server.Close)
+
+	p256dhBytes, _ := base64.RawURLEncoding.DecodeString("BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM")
+	sub := &Subscription{
+		Endpoint: server.URL + "/push/abc123",
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(p256dhBytes),
+			Auth:   base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+		},
+	}
+
+	client, err := NewClient(&mockSigner{pubKey: p256dhBytes}, "mailto:test@example.com", WithHTTPClient(server.Client()), WithRetryPolicy(policy))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client, sub, &requests
+}
+
+func fastRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+func TestRetry_TransientErrors(t *testing.T) {
+	client, sub, requests := newRetryTestClient(t, fastRetryPolicy(), nil,
+		http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	result, err := client.SendWithResult(context.Background(), sub, []byte("test"), nil)
+	if err != nil {
+		t.Fatalf("SendWithResult() error = %v", err)
+	}
+	if result.Attempts != 3 {
+		t.Errorf("Attempts = %d, want 3", result.Attempts)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
+
+func TestRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	client, sub, requests := newRetryTestClient(t, fastRetryPolicy(), nil,
+		http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+
+	err := client.Send(context.Background(), sub, []byte("test"), nil)
+	var pe *PushError
+	if !errors.As(err, &pe) || pe.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Send() error = %v, want 502 PushError", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+}
+
+func TestRetry_PermanentErrors(t *testing.T) {
+	for _, status := range []int{
+		http.StatusBadRequest,
+		http.StatusNotFound,
+		http.StatusGone,
+		http.StatusRequestEntityTooLarge,
+	} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			client, sub, requests := newRetryTestClient(t, fastRetryPolicy(), nil, status)
+
+			if err := client.Send(context.Background(), sub, []byte("test"), nil); err == nil {
+				t.Fatal("Send() expected error, got nil")
+			}
+			if got := requests.Load(); got != 1 {
+				t.Errorf("requests = %d, want 1", got)
+			}
+		})
+	}
+}
+
+// countingTransport counts the requests passed to its base RoundTripper.
+type countingTransport struct {
+	base     http.RoundTripper
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return t.base.RoundTrip(req)
+}
+
+func TestRetry_TransportErrors(t *testing.T) {
+	untrusted := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	untrusted.Config.ErrorLog = log.New(io.Discard, "", 0) // Handshake failures are expected
+	untrusted.StartTLS()
+	defer untrusted.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name         string
+		endpoint     string
+		wantRequests int32
+	}{
+		{"invalid endpoint", "https://push.example.com/%zz", 0},
+		{"unsupported scheme", "ftp://push.example.com/abc", 1},
+		{"untrusted certificate", untrusted.URL + "/push/abc", 1},
+		{"connection refused", closed.URL + "/push/abc", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Errors that aren't retried return at once; a retry would wait
+			// out the hour-long backoff until the context is canceled. The
+			// context has no deadline, which would disable the retry.
+			policy := fastRetryPolicy()
+			if tt.wantRequests <= 1 {
+				policy.InitialBackoff = time.Hour
+				policy.MaxBackoff = 0
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer time.AfterFunc(2*time.Second, cancel).Stop()
+
+			transport := &countingTransport{base: http.DefaultTransport}
+			client, err := NewClient(&mockSigner{pubKey: []byte("key")}, "mailto:test@example.com",
+				WithHTTPClient(&http.Client{Transport: transport}),
+				WithRetryPolicy(policy),
+			)
+			if err != nil {
+				t.Fatalf("NewClient() error = %v", err)
+			}
+			sub, _, _ := newTestSubscriber(t, "https://push.example.com/abc")
+			sub.Endpoint = tt.endpoint
+
+			err = client.Send(ctx, sub, []byte("test"), nil)
+			if err == nil || errors.Is(err, context.Canceled) {
+				t.Fatalf("Send() error = %v, want an immediate failure", err)
+			}
+			if got := transport.requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetry_RetryAfterExceedsLimit(t *testing.T) {
+	policy := fastRetryPolicy()
+	policy.MaxRetryAfter = time.Second
+	client, sub, requests := newRetryTestClient(t, policy, http.Header{"Retry-After": {"3600"}},
+		http.StatusTooManyRequests)
+
+	err := client.Send(context.Background(), sub, []byte("test"), nil)
+	if !IsRateLimited(err) {
+		t.Fatalf("Send() error = %v, want rate limited", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+}
+
+func TestRetry_ContextCanceledDuringBackoff(t *testing.T) {
+	policy := fastRetryPolicy()
+	policy.InitialBackoff = time.Hour
+	policy.MaxBackoff = 0
+	client, sub, _ := newRetryTestClient(t, policy, nil, http.StatusServiceUnavailable)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := client.Send(ctx, sub, []byte("test"), nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Send() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Send() took %v after cancellation", elapsed)
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+	want := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, w := range want {
+		if got := p.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(1); got < 50*time.Millisecond || got > 100*time.Millisecond {
+			t.Fatalf("backoff(1) with jitter = %v, want in [50ms, 100ms]", got)
+		}
+	}
+}
@@ -37,20 +37,7 @@ func (m *Memory) Save(_ context.Context, record *Record) error {
 	record.UpdatedAt = now
 
 	// Make a copy to avoid external mutations
-	stored := &Record{
-		ID:        record.ID,
-		UserID:    record.UserID,
-		CreatedAt: record.CreatedAt,
-		UpdatedAt: record.UpdatedAt,
-		Subscription: &webpush.Subscription{
-			Endpoint: record.Subscription.Endpoint,
-			Keys: webpush.Keys{
-				P256dh: record.Subscription.Keys.P256dh,
-				Auth:   record.Subscription.Keys.Auth,
-			},
-		},
-	}
-	m.records[record.ID] = stored
+	m.records[record.ID] = copyRecord(record)
 	return nil
 }
 
@@ -152,17 +139,22 @@ func (m *Memory) Close() error {
 }
 
 func copyRecord(r *Record) *Record {
-	return &Record{
-		ID:        r.ID,
-		UserID:    r.UserID,
-		CreatedAt: r.CreatedAt,
-		UpdatedAt: r.UpdatedAt,
-		Subscription: &webpush.Subscription{
-			Endpoint: r.Subscription.Endpoint,
-			Keys: webpush.Keys{
-				P256dh: r.Subscription.Keys.P256dh,
-				Auth:   r.Subscription.Keys.Auth,
-			},
+	sub := &webpush.Subscription{
+		Endpoint: r.Subscription.Endpoint,
+		Keys: webpush.Keys{
+			P256dh: r.Subscription.Keys.P256dh,
+			Auth:   r.Subscription.Keys.Auth,
 		},
 	}
+	if r.Subscription.ExpirationTime != nil {
+		expires := *r.Subscription.ExpirationTime
+		sub.ExpirationTime = &expires
+	}
+	return &Record{
+		ID:           r.ID,
+		UserID:       r.UserID,
+		CreatedAt:    r.CreatedAt,
+		UpdatedAt:    r.UpdatedAt,
+		Subscription: sub,
+	}
 }
@@ -31,6 +31,7 @@ func NewSQLite(dsn string) (*SQLite, error) {
 			endpoint TEXT NOT NULL UNIQUE,
 			p256dh TEXT NOT NULL,
 			auth TEXT NOT NULL,
+			expiration_time INTEGER,
 			created_at DATETIME NOT NULL,
 			updated_at DATETIME NOT NULL
 		);
@@ -42,6 +43,19 @@ func NewSQLite(dsn string) (*SQLite, error) {
 		return nil, fmt.Errorf("creating table: %w", err)
 	}
 
+	// Tables created before expiration_time was added lack the column
+	var hasExpiration bool
+	if err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info('subscriptions') WHERE name = 'expiration_time'`).Scan(&hasExpiration); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("checking schema: %w", err)
+	}
+	if !hasExpiration {
+		if _, err := db.Exec(`ALTER TABLE subscriptions ADD COLUMN expiration_time INTEGER`); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("adding expiration_time column: %w", err)
+		}
+	}
+
 	return &SQLite{db: db}, nil
 }
 
@@ -54,13 +68,14 @@ func (s *SQLite) Save(ctx context.Context, record *Record) error {
 	record.UpdatedAt = now
 
 	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO subscriptions (id, user_id, endpoint, p256dh, auth, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO subscriptions (id, user_id, endpoint, p256dh, auth, expiration_time, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(id) DO UPDATE SET
 			user_id = excluded.user_id,
 			endpoint = excluded.endpoint,
 			p256dh = excluded.p256dh,
 			auth = excluded.auth,
+			expiration_time = excluded.expiration_time,
 			updated_at = excluded.updated_at
 	`,
 		record.ID,
@@ -68,6 +83,7 @@ func (s *SQLite) Save(ctx context.Context, record *Record) error {
 		record.Subscription.Endpoint,
 		record.Subscription.Keys.P256dh,
 		record.Subscription.Keys.Auth,
+		record.Subscription.ExpirationTime,
 		record.CreatedAt,
 		record.UpdatedAt,
 	)
@@ -80,7 +96,7 @@ func (s *SQLite) Save(ctx context.Context, record *Record) error {
 // Get retrieves a subscription by ID.
 func (s *SQLite) Get(ctx context.Context, id string) (*Record, error) {
 	row := s.db.QueryRowContext(ctx, `
-		SELECT id, user_id, endpoint, p256dh, auth, created_at, updated_at
+		SELECT id, user_id, endpoint, p256dh, auth, expiration_time, created_at, updated_at
 		FROM subscriptions WHERE id = ?
 	`, id)
 	return scanRecord(row)
@@ -89,7 +105,7 @@ func (s *SQLite) Get(ctx context.Context, id string) (*Record, error) {
 // GetByEndpoint retrieves a subscription by its endpoint URL.
 func (s *SQLite) GetByEndpoint(ctx context.Context, endpoint string) (*Record, error) {
 	row := s.db.QueryRowContext(ctx, `
-		SELECT id, user_id, endpoint, p256dh, auth, created_at, updated_at
+		SELECT id, user_id, endpoint, p256dh, auth, expiration_time, created_at, updated_at
 		FROM subscriptions WHERE endpoint = ?
 	`, endpoint)
 	return scanRecord(row)
@@ -98,7 +114,7 @@ func (s *SQLite) GetByEndpoint(ctx context.Context, endpoint string) (*Record, e
 // GetByUserID retrieves all subscriptions for a user.
 func (s *SQLite) GetByUserID(ctx context.Context, userID string) ([]*Record, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, user_id, endpoint, p256dh, auth, created_at, updated_at
+		SELECT id, user_id, endpoint, p256dh, auth, expiration_time, created_at, updated_at
 		FROM subscriptions WHERE user_id = ?
 	`, userID)
 	if err != nil {
@@ -143,7 +159,7 @@ func (s *SQLite) DeleteByEndpoint(ctx context.Context, endpoint string) error {
 // List returns all subscriptions with pagination.
 func (s *SQLite) List(ctx context.Context, limit, offset int) ([]*Record, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, user_id, endpoint, p256dh, auth, created_at, updated_at
+		SELECT id, user_id, endpoint, p256dh, auth, expiration_time, created_at, updated_at
 		FROM subscriptions
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?
@@ -171,28 +187,33 @@ func scanRecord(row scanner) (*Record, error) {
 		endpoint  string
 		p256dh    string
 		auth      string
+		expires   sql.NullInt64
 		createdAt time.Time
 		updatedAt time.Time
 	)
-	err := row.Scan(&id, &userID, &endpoint, &p256dh, &auth, &createdAt, &updatedAt)
+	err := row.Scan(&id, &userID, &endpoint, &p256dh, &auth, &expires, &createdAt, &updatedAt)
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("scanning row: %w", err)
 	}
-	return &Record{
-		ID:        id,
-		UserID:    userID.String,
-		CreatedAt: createdAt,
-		UpdatedAt: updatedAt,
-		Subscription: &webpush.Subscription{
-			Endpoint: endpoint,
-			Keys: webpush.Keys{
-				P256dh: p256dh,
-				Auth:   auth,
-			},
+	sub := &webpush.Subscription{
+		Endpoint: endpoint,
+		Keys: webpush.Keys{
+			P256dh: p256dh,
+			Auth:   auth,
 		},
+	}
+	if expires.Valid {
+		sub.ExpirationTime = &expires.Int64
+	}
+	return &Record{
+		ID:           id,
+		UserID:       userID.String,
+		CreatedAt:    createdAt,
+		UpdatedAt:    updatedAt,
+		Subscription: sub,
 	}, nil
 }
 
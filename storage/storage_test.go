@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"path/filepath"
 	"testing"
 
 	"github.com/imjasonh/webpush"
@@ -22,10 +24,53 @@ func TestSQLite(t *testing.T) {
 	testStorage(t, storage)
 }
 
+func TestSQLite_AddsExpirationColumn(t *testing.T) {
+	// A database created before subscriptions stored their expiration time
+	dsn := filepath.Join(t.TempDir(), "webpush.db")
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	if _, err := db.Exec(`
+		CREATE TABLE subscriptions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT,
+			endpoint TEXT NOT NULL UNIQUE,
+			p256dh TEXT NOT NULL,
+			auth TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		INSERT INTO subscriptions VALUES ('old', 'user-1', 'https://push.example.com/old', 'key', 'auth', '2025-01-01 00:00:00', '2025-01-01 00:00:00');
+	`); err != nil {
+		t.Fatalf("creating old schema: %v", err)
+	}
+	db.Close()
+
+	storage, err := NewSQLite(dsn)
+	if err != nil {
+		t.Fatalf("NewSQLite() error = %v", err)
+	}
+	defer storage.Close()
+
+	got, err := storage.Get(context.Background(), "old")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Subscription.ExpirationTime != nil {
+		t.Errorf("Get() ExpirationTime = %d, want nil", *got.Subscription.ExpirationTime)
+	}
+	if err := storage.Delete(context.Background(), "old"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	testStorage(t, storage)
+}
+
 func testStorage(t *testing.T, s Storage) {
 	ctx := context.Background()
 
 	// Test Save and Get
+	expires := int64(1767225600000)
 	record := &Record{
 		ID:     "test-id-1",
 		UserID: "user-1",
@@ -35,6 +80,7 @@ func testStorage(t *testing.T, s Storage) {
 				P256dh: "BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM",
 				Auth:   "tBHItJI5svbpez7KI4CCXg",
 			},
+			ExpirationTime: &expires,
 		},
 	}
 
@@ -59,6 +105,9 @@ func testStorage(t *testing.T, s Storage) {
 	if got.CreatedAt.IsZero() {
 		t.Error("Get() CreatedAt is zero")
 	}
+	if got.Subscription.ExpirationTime == nil || *got.Subscription.ExpirationTime != expires {
+		t.Errorf("Get() ExpirationTime = %v, want %d", got.Subscription.ExpirationTime, expires)
+	}
 
 	// Get by endpoint
 	got, err = s.GetByEndpoint(ctx, record.Subscription.Endpoint)
@@ -94,6 +143,15 @@ func testStorage(t *testing.T, s Storage) {
 		t.Fatalf("Save() error = %v", err)
 	}
 
+	// A subscription without an expiration time stays without one
+	got, err = s.Get(ctx, record2.ID)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Subscription.ExpirationTime != nil {
+		t.Errorf("Get() ExpirationTime = %d, want nil", *got.Subscription.ExpirationTime)
+	}
+
 	// Get by user ID should return 2
 	records, err = s.GetByUserID(ctx, "user-1")
 	if err != nil {
@@ -0,0 +1,146 @@
+package webpush
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const authSecretSize = 16
+
+// maxExpirationTime is the latest accepted expirationTime, the end of year
+// 9999 in milliseconds since the Unix epoch. It keeps values far from the
+// limit of int64, which float64 can't represent exactly.
+const maxExpirationTime = 253402300799999
+
+// ExpiresAt returns when the subscription expires, or the zero Time if it
+// doesn't.
+func (s *Subscription) ExpiresAt() time.Time {
+	if s.ExpirationTime == nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(*s.ExpirationTime)
+}
+
+// ParseSubscription parses and validates a subscription from the JSON
+// produced by PushSubscription.toJSON() in the browser.
+//
+// The endpoint must be an https URL without userinfo or a fragment, and its
+// host must not be localhost or a loopback, private or link-local IP
+// address. The p256dh key must be an uncompressed P-256 point and the auth
+// secret 16 bytes. Keys may use any base64 variant and are normalized to
+// unpadded base64url.
+// Invalid fields are reported as a *ValidationError.
+func ParseSubscription(data []byte) (*Subscription, error) {
+	var raw struct {
+		Endpoint       string   `json:"endpoint"`
+		Keys           Keys     `json:"keys"`
+		ExpirationTime *float64 `json:"expirationTime"` // a DOMHighResTimeStamp
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("unmarshaling subscription: %w", err)
+	}
+
+	if err := validateEndpoint(raw.Endpoint); err != nil {
+		return nil, err
+	}
+
+	p256dh, err := decodeKey("keys.p256dh", raw.Keys.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return nil, &ValidationError{Field: "keys.p256dh", Value: raw.Keys.P256dh, Reason: "must be an uncompressed P-256 public key"}
+	}
+
+	auth, err := decodeKey("keys.auth", raw.Keys.Auth)
+	if err != nil {
+		return nil, err
+	}
+	if len(auth) != authSecretSize {
+		return nil, &ValidationError{Field: "keys.auth", Value: raw.Keys.Auth, Reason: fmt.Sprintf("must be %d bytes, got %d", authSecretSize, len(auth))}
+	}
+
+	sub := &Subscription{
+		Endpoint: raw.Endpoint,
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(p256dh),
+			Auth:   base64.RawURLEncoding.EncodeToString(auth),
+		},
+	}
+	if raw.ExpirationTime != nil {
+		ms := *raw.ExpirationTime
+		if ms < 0 || ms > maxExpirationTime {
+			return nil, &ValidationError{Field: "expirationTime", Value: fmt.Sprint(ms), Reason: "must be a time in milliseconds since the Unix epoch"}
+		}
+		expires := int64(ms)
+		sub.ExpirationTime = &expires
+	}
+	return sub, nil
+}
+
+// validateEndpoint checks that a subscription endpoint is safe to send
+// requests to. Only IP address hosts are checked; host names aren't
+// resolved.
+func validateEndpoint(endpoint string) error {
+	invalid := func(reason string) error {
+		return &ValidationError{Field: "endpoint", Value: endpoint, Reason: reason}
+	}
+	if endpoint == "" {
+		return invalid("is required")
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return invalid("must be a valid URL")
+	}
+	if u.Scheme != "https" {
+		return invalid("must use HTTPS")
+	}
+	if u.Host == "" {
+		return invalid("must have a host")
+	}
+	if u.User != nil {
+		return invalid("must not contain userinfo")
+	}
+	if u.Fragment != "" || strings.Contains(endpoint, "#") {
+		return invalid("must not contain a fragment")
+	}
+
+	// Resolvers treat a trailing dot as the same name, and localhost and
+	// its subdomains as loopback (RFC 6761 section 6.3).
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return invalid("must not be a loopback address")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		switch {
+		case ip.IsLoopback():
+			return invalid("must not be a loopback address")
+		case ip.IsPrivate():
+			return invalid("must not be a private address")
+		case ip.IsUnspecified(), ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast(), ip.IsMulticast():
+			return invalid("must be a public unicast address")
+		}
+	}
+	return nil
+}
+
+// decodeKey decodes a subscription key, accepting base64url or standard
+// base64 with or without padding.
+func decodeKey(field, value string) ([]byte, error) {
+	if value == "" {
+		return nil, &ValidationError{Field: field, Value: value, Reason: "is required"}
+	}
+	trimmed := strings.TrimRight(value, "=")
+	for _, enc := range []*base64.Encoding{base64.RawURLEncoding, base64.RawStdEncoding} {
+		if b, err := enc.DecodeString(trimmed); err == nil {
+			return b, nil
+		}
+	}
+	return nil, &ValidationError{Field: field, Value: value, Reason: "must be base64 encoded"}
+}
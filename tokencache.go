@@ -0,0 +1,93 @@
+package webpush
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenCacheOptions configures how Client reuses signed VAPID tokens.
+//
+// Signing a token can be expensive (with KMSSigner it is a network call), so
+// by default a token is signed once per push service origin and reused until
+// it nears expiry.
+type TokenCacheOptions struct {
+	Disabled      bool          // Sign a new token for every send
+	Lifetime      time.Duration // Maximum time a token is reused (0 = until RefreshMargin before it expires)
+	RefreshMargin time.Duration // Sign a new token once the cached one expires within this margin (at most half its validity)
+}
+
+// DefaultTokenCacheOptions returns the token cache configuration used by
+// NewClient: tokens are reused until an hour before they expire.
+func DefaultTokenCacheOptions() TokenCacheOptions {
+	return TokenCacheOptions{
+		RefreshMargin: time.Hour,
+	}
+}
+
+// tokenCache caches signed VAPID JWTs by audience. It is safe for concurrent
+// use, and concurrent requests for the same audience sign only once.
+type tokenCache struct {
+	opts TokenCacheOptions
+
+	mu      sync.Mutex
+	entries map[string]*tokenEntry
+}
+
+type tokenEntry struct {
+	mu       sync.Mutex
+	token    string
+	signedAt time.Time
+	expires  time.Time
+}
+
+// signFunc signs a token for audience, returning it and its expiration time.
+type signFunc func(ctx context.Context, audience string) (string, time.Time, error)
+
+func newTokenCache(opts TokenCacheOptions) *tokenCache {
+	return &tokenCache{
+		opts:    opts,
+		entries: make(map[string]*tokenEntry),
+	}
+}
+
+// get returns a cached token for audience if it's still fresh at now, or
+// signs and caches a new one.
+func (tc *tokenCache) get(ctx context.Context, audience string, now time.Time, sign signFunc) (string, error) {
+	tc.mu.Lock()
+	entry, ok := tc.entries[audience]
+	if !ok {
+		entry = &tokenEntry{}
+		tc.entries[audience] = entry
+	}
+	tc.mu.Unlock()
+
+	// Holding the entry lock while signing means concurrent callers wait for
+	// a single signature rather than each making their own.
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.token != "" && tc.fresh(entry, now) {
+		return entry.token, nil
+	}
+
+	token, expires, err := sign(ctx, audience)
+	if err != nil {
+		return "", err
+	}
+	entry.token = token
+	entry.signedAt = now
+	entry.expires = expires
+	return token, nil
+}
+
+// fresh reports whether entry can still be used at now. The refresh margin
+// is capped at half the token's validity, so tokens with a short expiration
+// are still reused rather than being stale as soon as they are signed.
+func (tc *tokenCache) fresh(entry *tokenEntry, now time.Time) bool {
+	if tc.opts.Lifetime > 0 && now.Sub(entry.signedAt) >= tc.opts.Lifetime {
+		return false
+	}
+	margin := min(tc.opts.RefreshMargin, entry.expires.Sub(entry.signedAt)/2)
+	return now.Before(entry.expires.Add(-margin))
+}
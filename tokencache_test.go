@@ -0,0 +1,170 @@
+package webpush
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingSigner is a mockSigner that counts calls to Sign.
+type countingSigner struct {
+	mockSigner
+	calls atomic.Int32
+}
+
+func (s *countingSigner) Sign(ctx context.Context, data []byte) ([]byte, error) {
+	s.calls.Add(1)
+	return s.mockSigner.Sign(ctx, data)
+}
+
+func TestTokenCache(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	p256dhBytes, _ := base64.RawURLEncoding.DecodeString("BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM")
+	sub := &Subscription{
+		Endpoint: server.URL + "/push/abc123",
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(p256dhBytes),
+			Auth:   base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+		},
+	}
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer := &countingSigner{mockSigner: mockSigner{pubKey: p256dhBytes}}
+	client, err := NewClient(signer, "mailto:test@example.com", WithClock(func() time.Time { return now }), WithHTTPClient(server.Client()))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	// Concurrent sends to the same push service share one signature.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+				t.Errorf("Send() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := signer.calls.Load(); got != 1 {
+		t.Errorf("Sign() calls = %d, want 1", got)
+	}
+
+	// Within the refresh margin of expiry, a new token is signed.
+	now = now.Add(11*time.Hour + time.Minute)
+	if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got := signer.calls.Load(); got != 2 {
+		t.Errorf("Sign() calls = %d, want 2", got)
+	}
+}
+
+func TestTokenCache_ShortExpiration(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc123")
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer := &countingSigner{mockSigner: mockSigner{pubKey: []byte("key")}}
+	client, err := NewClient(signer, "mailto:test@example.com",
+		WithVAPIDExpiration(30*time.Minute), // Shorter than the default refresh margin
+		WithClock(func() time.Time { return now }),
+		WithHTTPClient(server.Client()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	for range 5 {
+		if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if got := signer.calls.Load(); got != 1 {
+		t.Errorf("Sign() calls = %d, want 1", got)
+	}
+
+	// Past half the token's validity, a new token is signed.
+	now = now.Add(16 * time.Minute)
+	if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if got := signer.calls.Load(); got != 2 {
+		t.Errorf("Sign() calls = %d, want 2", got)
+	}
+}
+
+func TestTokenCache_Fresh(t *testing.T) {
+	signedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	entry := &tokenEntry{
+		token:    "token",
+		signedAt: signedAt,
+		expires:  signedAt.Add(12 * time.Hour),
+	}
+
+	tests := []struct {
+		name string
+		opts TokenCacheOptions
+		at   time.Duration
+		want bool
+	}{
+		{"fresh", TokenCacheOptions{RefreshMargin: time.Hour}, time.Hour, true},
+		{"in refresh margin", TokenCacheOptions{RefreshMargin: time.Hour}, 11 * time.Hour, false},
+		{"expired", TokenCacheOptions{}, 12 * time.Hour, false},
+		{"past lifetime", TokenCacheOptions{Lifetime: 30 * time.Minute}, time.Hour, false},
+		{"within lifetime", TokenCacheOptions{Lifetime: 2 * time.Hour}, time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTokenCache(tt.opts)
+			if got := tc.fresh(entry, signedAt.Add(tt.at)); got != tt.want {
+				t.Errorf("fresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenCache_Disabled(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	p256dhBytes, _ := base64.RawURLEncoding.DecodeString("BNcRdreALRFXTkOOUHK1EtK2wtaz5Ry4YfYCA_0QTpQtUbVlUls0VJXg7A8u-Ts1XbjhazAkj7I99e8QcYP7DkM")
+	sub := &Subscription{
+		Endpoint: server.URL + "/push/abc123",
+		Keys: Keys{
+			P256dh: base64.RawURLEncoding.EncodeToString(p256dhBytes),
+			Auth:   base64.RawURLEncoding.EncodeToString(make([]byte, 16)),
+		},
+	}
+
+	signer := &countingSigner{mockSigner: mockSigner{pubKey: p256dhBytes}}
+	client, err := NewClient(signer, "mailto:test@example.com", WithHTTPClient(server.Client()), WithTokenCache(TokenCacheOptions{Disabled: true}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	for range 3 {
+		if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if got := signer.calls.Load(); got != 3 {
+		t.Errorf("Sign() calls = %d, want 3", got)
+	}
+}
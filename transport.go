@@ -0,0 +1,127 @@
+package webpush
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"time"
+)
+
+// TransportOptions configures the HTTP transport used to reach push services.
+//
+// Sends are concentrated on a handful of push service hosts, so the default
+// transport keeps many idle connections per host and negotiates HTTP/2,
+// letting concurrent sends share connections instead of dialing new ones.
+type TransportOptions struct {
+	MaxIdleConnsPerHost   int           // Idle connections kept per push service host
+	MaxConnsPerHost       int           // Limit on connections per host (0 = unlimited)
+	IdleConnTimeout       time.Duration // How long an idle connection is kept
+	DialTimeout           time.Duration // Limit on establishing a TCP connection
+	TLSHandshakeTimeout   time.Duration // Limit on the TLS handshake
+	ResponseHeaderTimeout time.Duration // Limit on waiting for response headers after sending a request
+	TLSClientConfig       *tls.Config   // TLS configuration (default: system roots)
+}
+
+// DefaultTransportOptions returns the transport configuration used by
+// NewClient.
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{
+		MaxIdleConnsPerHost:   100,
+		IdleConnTimeout:       90 * time.Second,
+		DialTimeout:           10 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	}
+}
+
+// NewTransport returns an HTTP transport tuned for sending push messages.
+// It negotiates HTTP/2 where the push service supports it.
+func NewTransport(opts TransportOptions) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   opts.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	var tlsConfig *tls.Config
+	if opts.TLSClientConfig != nil {
+		tlsConfig = opts.TLSClientConfig.Clone()
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          0, // No overall limit; MaxIdleConnsPerHost applies
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: opts.ResponseHeaderTimeout,
+		TLSClientConfig:       tlsConfig,
+	}
+}
+
+// WithTransport sets the options of the HTTP transport used to send
+// requests, replacing any HTTP client set earlier.
+func WithTransport(opts TransportOptions) ClientOption {
+	return func(c *Client) error {
+		c.httpClient = &http.Client{Transport: NewTransport(opts)}
+		return nil
+	}
+}
+
+// ConnStats counts how requests to push services used connections. A low
+// ratio of reused to new connections suggests the idle pool is too small.
+type ConnStats struct {
+	Requests    int64 // Requests sent
+	NewConns    int64 // Requests that dialed a new connection
+	ReusedConns int64 // Requests sent on a previously used connection
+	HTTP2       int64 // Requests answered over HTTP/2
+}
+
+// ReuseRatio returns the fraction of requests sent on a reused connection,
+// or 0 if no requests have been sent.
+func (s ConnStats) ReuseRatio() float64 {
+	if total := s.NewConns + s.ReusedConns; total > 0 {
+		return float64(s.ReusedConns) / float64(total)
+	}
+	return 0
+}
+
+// connStats holds the live counters behind ConnStats.
+type connStats struct {
+	requests, newConns, reusedConns, http2 atomic.Int64
+}
+
+// ConnStats returns connection usage counts for requests sent by the Client,
+// including retries and cancellations.
+func (c *Client) ConnStats() ConnStats {
+	return ConnStats{
+		Requests:    c.stats.requests.Load(),
+		NewConns:    c.stats.newConns.Load(),
+		ReusedConns: c.stats.reusedConns.Load(),
+		HTTP2:       c.stats.http2.Load(),
+	}
+}
+
+// do sends a request with the Client's HTTP client, recording connection
+// usage.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	c.stats.requests.Add(1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				c.stats.reusedConns.Add(1)
+			} else {
+				c.stats.newConns.Add(1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := c.httpClient.Do(req)
+	if err == nil && resp.ProtoMajor == 2 {
+		c.stats.http2.Add(1)
+	}
+	return resp, err
+}
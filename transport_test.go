@@ -0,0 +1,60 @@
+package webpush
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewTransport(t *testing.T) {
+	tr := NewTransport(DefaultTransportOptions())
+	if !tr.ForceAttemptHTTP2 {
+		t.Error("ForceAttemptHTTP2 = false, want true")
+	}
+	if tr.MaxIdleConnsPerHost != 100 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want 100", tr.MaxIdleConnsPerHost)
+	}
+	if tr.ResponseHeaderTimeout != 30*time.Second {
+		t.Errorf("ResponseHeaderTimeout = %v, want 30s", tr.ResponseHeaderTimeout)
+	}
+}
+
+func TestClient_ConnStats(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	opts := DefaultTransportOptions()
+	opts.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+	client, err := NewClient(&mockSigner{}, "mailto:test@example.com", WithTransport(opts))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	sub, _, _ := newTestSubscriber(t, server.URL+"/push/abc")
+	const sends = 5
+	for range sends {
+		if err := client.Send(context.Background(), sub, []byte("test"), nil); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	want := ConnStats{Requests: sends, NewConns: 1, ReusedConns: sends - 1, HTTP2: sends}
+	if got := client.ConnStats(); got != want {
+		t.Errorf("ConnStats() = %+v, want %+v", got, want)
+	}
+	if got, want := client.ConnStats().ReuseRatio(), 0.8; got != want {
+		t.Errorf("ReuseRatio() = %v, want %v", got, want)
+	}
+}
+
+func TestConnStats_ReuseRatio_NoRequests(t *testing.T) {
+	if got := (ConnStats{}).ReuseRatio(); got != 0 {
+		t.Errorf("ReuseRatio() = %v, want 0", got)
+	}
+}
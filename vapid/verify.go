@@ -0,0 +1,199 @@
+package vapid
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MaxExpiration is the longest lifetime RFC 8292 permits for a VAPID JWT.
+const MaxExpiration = 24 * time.Hour
+
+// Header holds VAPID credentials parsed from a push request.
+type Header struct {
+	Token     string // Signed JWT
+	PublicKey []byte // Application server's P-256 public key, uncompressed
+	Legacy    bool   // Whether the credentials used the legacy WebPush scheme
+}
+
+// Claims are the verified claims of a VAPID JWT.
+type Claims struct {
+	Audience string    // Origin of the push service
+	Expires  time.Time // When the JWT expires
+	Subject  string    // Contact URI for the application server
+}
+
+// ParseHeader parses VAPID credentials from push request headers. It accepts
+// the RFC 8292 form:
+//
+//	Authorization: vapid t=<jwt>, k=<key>
+//
+// and the legacy form from earlier drafts:
+//
+//	Authorization: WebPush <jwt>
+//	Crypto-Key: p256ecdsa=<key>
+func ParseHeader(h http.Header) (*Header, error) {
+	scheme, params, _ := strings.Cut(strings.TrimSpace(h.Get("Authorization")), " ")
+	var hdr Header
+	var key string
+	switch {
+	case strings.EqualFold(scheme, "vapid"):
+		for _, param := range strings.Split(params, ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			switch k {
+			case "t":
+				hdr.Token = v
+			case "k":
+				key = v
+			}
+		}
+	case strings.EqualFold(scheme, "WebPush"):
+		hdr.Token = strings.TrimSpace(params)
+		hdr.Legacy = true
+		key = cryptoKeyParam(h.Get("Crypto-Key"), "p256ecdsa")
+	default:
+		return nil, errors.New("authorization scheme is not vapid or WebPush")
+	}
+	if hdr.Token == "" {
+		return nil, errors.New("missing VAPID token")
+	}
+	if key == "" {
+		return nil, errors.New("missing VAPID public key")
+	}
+
+	pubKey, err := DecodeApplicationServerKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("decoding VAPID public key: %w", err)
+	}
+	if x, _ := elliptic.Unmarshal(elliptic.P256(), pubKey); x == nil {
+		return nil, errors.New("VAPID public key is not an uncompressed P-256 point")
+	}
+	hdr.PublicKey = pubKey
+	return &hdr, nil
+}
+
+// cryptoKeyParam returns the named parameter from a Crypto-Key header, whose
+// entries may be separated by commas or semicolons.
+func cryptoKeyParam(value, name string) string {
+	for _, param := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && k == name {
+			return strings.Trim(v, `"`)
+		}
+	}
+	return ""
+}
+
+// Verify parses VAPID credentials from push request headers and verifies
+// them for a push service at audience (e.g. "https://push.example.com"). See
+// Header.Verify for the checks performed.
+func Verify(h http.Header, audience string, now time.Time) (*Claims, error) {
+	hdr, err := ParseHeader(h)
+	if err != nil {
+		return nil, err
+	}
+	return hdr.Verify(audience, now)
+}
+
+// Verify checks the JWT's ES256 signature against the public key, that its
+// aud claim matches audience, that it expires after now but no more than 24
+// hours later, and that its sub claim is a valid contact URI.
+func (h *Header) Verify(audience string, now time.Time) (*Claims, error) {
+	parts := strings.Split(h.Token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWT header: %w", err)
+	}
+	var jwtHeader struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &jwtHeader); err != nil {
+		return nil, fmt.Errorf("parsing JWT header: %w", err)
+	}
+	if jwtHeader.Alg != "ES256" {
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", jwtHeader.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != 64 {
+		return nil, errors.New("malformed JWT signature")
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), h.PublicKey)
+	if x == nil {
+		return nil, errors.New("VAPID public key is not an uncompressed P-256 point")
+	}
+	pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if !ecdsa.Verify(pub, hash[:], new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])) {
+		return nil, errors.New("invalid JWT signature")
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWT claims: %w", err)
+	}
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, fmt.Errorf("parsing JWT claims: %w", err)
+	}
+
+	if claims.Aud != audience {
+		return nil, fmt.Errorf("JWT aud %q does not match %q", claims.Aud, audience)
+	}
+	expires := time.Unix(claims.Exp, 0)
+	if !expires.After(now) {
+		return nil, fmt.Errorf("JWT expired at %v", expires)
+	}
+	if expires.After(now.Add(MaxExpiration)) {
+		return nil, fmt.Errorf("JWT expiration %v is more than %v in the future", expires, MaxExpiration)
+	}
+	if err := ValidateSubject(claims.Sub); err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		Audience: claims.Aud,
+		Expires:  expires,
+		Subject:  claims.Sub,
+	}, nil
+}
+
+// ValidateSubject checks that subject is a mailto: URI with a valid email
+// address or an https: URL, as required by RFC 8292.
+func ValidateSubject(subject string) error {
+	u, err := url.Parse(subject)
+	if err != nil {
+		return fmt.Errorf("parsing VAPID subject: %w", err)
+	}
+	switch u.Scheme {
+	case "mailto":
+		addr, err := mail.ParseAddress(u.Opaque)
+		if err != nil || addr.Address != u.Opaque {
+			return fmt.Errorf("VAPID subject %q is not a valid mailto: URI", subject)
+		}
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("VAPID subject %q has no host", subject)
+		}
+	default:
+		return fmt.Errorf("VAPID subject must be a mailto: or https: URI, got %q", subject)
+	}
+	return nil
+}
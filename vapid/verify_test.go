@@ -0,0 +1,171 @@
+package vapid
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNow = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// signToken returns a JWT with the given claims signed by key.
+func signToken(t *testing.T, key *ecdsa.PrivateKey, alg string, claims map[string]any) string {
+	t.Helper()
+	headerJSON, _ := json.Marshal(map[string]string{"typ": "JWT", "alg": alg})
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." +
+		base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	hash := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	return key, ApplicationServerKey(elliptic.Marshal(elliptic.P256(), key.X, key.Y))
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"aud": "https://push.example.com",
+		"exp": testNow.Add(12 * time.Hour).Unix(),
+		"sub": "mailto:admin@example.com",
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	key, pub := newKey(t)
+	token := signToken(t, key, "ES256", validClaims())
+
+	tests := []struct {
+		name       string
+		header     http.Header
+		wantLegacy bool
+		wantErr    bool
+	}{
+		{"vapid", http.Header{"Authorization": {"vapid t=" + token + ", k=" + pub}}, false, false},
+		{"vapid reordered", http.Header{"Authorization": {"vapid k=" + pub + ",t=" + token}}, false, false},
+		{"legacy", http.Header{
+			"Authorization": {"WebPush " + token},
+			"Crypto-Key":    {"dh=BAAA;p256ecdsa=" + pub},
+		}, true, false},
+		{"legacy comma separated", http.Header{
+			"Authorization": {"WebPush " + token},
+			"Crypto-Key":    {"dh=BAAA, p256ecdsa=" + pub},
+		}, true, false},
+		{"missing", http.Header{}, false, true},
+		{"bearer", http.Header{"Authorization": {"Bearer " + token}}, false, true},
+		{"missing key", http.Header{"Authorization": {"vapid t=" + token}}, false, true},
+		{"legacy missing key", http.Header{"Authorization": {"WebPush " + token}}, false, true},
+		{"invalid key", http.Header{"Authorization": {"vapid t=" + token + ", k=AAAA"}}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr, err := ParseHeader(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if hdr.Token != token {
+				t.Errorf("Token = %q, want %q", hdr.Token, token)
+			}
+			if ApplicationServerKey(hdr.PublicKey) != pub {
+				t.Errorf("PublicKey = %q, want %q", ApplicationServerKey(hdr.PublicKey), pub)
+			}
+			if hdr.Legacy != tt.wantLegacy {
+				t.Errorf("Legacy = %v, want %v", hdr.Legacy, tt.wantLegacy)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key, pub := newKey(t)
+	otherKey, _ := newKey(t)
+
+	with := func(k string, v any) map[string]any {
+		claims := validClaims()
+		claims[k] = v
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signToken(t, key, "ES256", validClaims()), ""},
+		{"https subject", signToken(t, key, "ES256", with("sub", "https://example.com")), ""},
+		{"wrong signer", signToken(t, otherKey, "ES256", validClaims()), "signature"},
+		{"wrong algorithm", signToken(t, key, "HS256", validClaims()), "algorithm"},
+		{"wrong audience", signToken(t, key, "ES256", with("aud", "https://other.example.com")), "aud"},
+		{"expired", signToken(t, key, "ES256", with("exp", testNow.Add(-time.Minute).Unix())), "expired"},
+		{"expires too late", signToken(t, key, "ES256", with("exp", testNow.Add(25*time.Hour).Unix())), "future"},
+		{"bad subject", signToken(t, key, "ES256", with("sub", "admin@example.com")), "subject"},
+		{"malformed", "abc.def", "malformed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{"Authorization": {"vapid t=" + tt.token + ", k=" + pub}}
+			claims, err := Verify(h, "https://push.example.com", testNow)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Verify() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+			if claims.Audience != "https://push.example.com" {
+				t.Errorf("Audience = %q", claims.Audience)
+			}
+			if !claims.Expires.Equal(testNow.Add(12 * time.Hour)) {
+				t.Errorf("Expires = %v, want %v", claims.Expires, testNow.Add(12*time.Hour))
+			}
+		})
+	}
+}
+
+func TestValidateSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		wantErr bool
+	}{
+		{"mailto:admin@example.com", false},
+		{"https://example.com/contact", false},
+		{"", true},
+		{"mailto:", true},
+		{"mailto:Admin <admin@example.com>", true},
+		{"http://example.com", true},
+		{"https://", true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateSubject(tt.subject); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateSubject(%q) error = %v, wantErr %v", tt.subject, err, tt.wantErr)
+		}
+	}
+}
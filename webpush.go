@@ -5,30 +5,28 @@ package webpush
 import (
 	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/ecdh"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
-	"encoding/binary"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
-	"strings"
 	"time"
 
-	"golang.org/x/crypto/hkdf"
+	"github.com/imjasonh/webpush/vapid"
 )
 
 // Subscription represents a Web Push subscription from a client.
 type Subscription struct {
 	Endpoint string `json:"endpoint"`
 	Keys     Keys   `json:"keys"`
+
+	// ExpirationTime is when the subscription expires, in milliseconds
+	// since the Unix epoch, or nil if it doesn't.
+	ExpirationTime *int64 `json:"expirationTime,omitempty"`
 }
 
 // Keys contains the client's encryption keys.
@@ -39,9 +37,131 @@ type Keys struct {
 
 // Options configures the web push notification.
 type Options struct {
-	TTL     int    // Time-to-live in seconds (default 2419200 = 4 weeks)
-	Urgency string // Urgency level: very-low, low, normal, high
-	Topic   string // Topic for message replacement
+	TTL             time.Duration   // Time-to-live, in whole seconds (default and maximum MaxTTL); see ZeroTTL
+	Urgency         Urgency         // Urgency level (default Normal)
+	Topic           string          // Topic for message replacement; at most 32 base64url characters
+	ContentEncoding ContentEncoding // Payload encryption scheme (default AES128GCM)
+	Padding         Padding         // Padding to hide the payload length (default none)
+
+	// ReceiptSubscription is sent as the Push-Receipt header, asking the
+	// push service for a delivery receipt (RFC 8030 section 5.1). It must
+	// be a receipt subscription the push service created; this package
+	// doesn't create them or fetch receipts from them. Relays and pushtest
+	// instead POST receipts to this URL; see ReceiptHandler.
+	ReceiptSubscription string
+
+	// Header holds additional request headers, such as those needed by an
+	// internal relay. They can't replace the headers set by the Client.
+	Header http.Header
+}
+
+const (
+	// MaxTTL is the longest time a push service is asked to store a
+	// message. Longer TTLs are reduced to MaxTTL, as some push services
+	// reject them.
+	MaxTTL = 28 * 24 * time.Hour
+
+	// ZeroTTL requests a TTL of zero: the message is delivered only if the
+	// user agent is connected right now, and dropped otherwise. It suits
+	// real-time notifications such as incoming calls.
+	ZeroTTL time.Duration = -1
+)
+
+// Urgency indicates how soon a push message must be delivered, which lets
+// push services save battery by deferring less urgent messages (RFC 8030
+// section 5.3).
+type Urgency string
+
+// Urgency levels, from least to most urgent.
+const (
+	VeryLow Urgency = "very-low" // On power and Wi-Fi
+	Low     Urgency = "low"      // On either power or Wi-Fi
+	Normal  Urgency = "normal"   // On neither power nor Wi-Fi
+	High    Urgency = "high"     // Low battery
+)
+
+// valid reports whether u is one of the defined urgency levels.
+func (u Urgency) valid() bool {
+	switch u {
+	case VeryLow, Low, Normal, High:
+		return true
+	}
+	return false
+}
+
+// topicPattern matches valid Topic values: at most 32 characters from the
+// URL and filename safe base64 alphabet (RFC 8030 section 5.4).
+var topicPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// ValidTopic reports whether topic is a valid Topic header value: 1 to 32
+// characters from the URL and filename safe base64 alphabet.
+func ValidTopic(topic string) bool {
+	return topicPattern.MatchString(topic)
+}
+
+// merge returns o with the fields set in override replacing its own.
+func (o Options) merge(override *Options) Options {
+	if override == nil {
+		return o
+	}
+	if override.TTL != 0 {
+		o.TTL = override.TTL
+	}
+	if override.Urgency != "" {
+		o.Urgency = override.Urgency
+	}
+	if override.Topic != "" {
+		o.Topic = override.Topic
+	}
+	if override.ContentEncoding != "" {
+		o.ContentEncoding = override.ContentEncoding
+	}
+	if override.Padding != nil {
+		o.Padding = override.Padding
+	}
+	if override.ReceiptSubscription != "" {
+		o.ReceiptSubscription = override.ReceiptSubscription
+	}
+	if override.Header != nil {
+		header := o.Header.Clone()
+		if header == nil {
+			header = make(http.Header, len(override.Header))
+		}
+		for k, v := range override.Header {
+			header[http.CanonicalHeaderKey(k)] = v
+		}
+		o.Header = header
+	}
+	return o
+}
+
+// validate checks the options that are sent verbatim as request headers.
+func (o *Options) validate() error {
+	if o.TTL < 0 && o.TTL != ZeroTTL {
+		return &ValidationError{Field: "TTL", Value: o.TTL.String(), Reason: "must be positive or ZeroTTL"}
+	}
+	if o.TTL > 0 && o.TTL < time.Second {
+		return &ValidationError{Field: "TTL", Value: o.TTL.String(), Reason: "must be at least 1s or ZeroTTL"}
+	}
+	if o.Urgency != "" && !o.Urgency.valid() {
+		return &ValidationError{Field: "Urgency", Value: string(o.Urgency), Reason: "must be very-low, low, normal or high"}
+	}
+	if o.Topic != "" && !ValidTopic(o.Topic) {
+		return &ValidationError{Field: "Topic", Value: o.Topic, Reason: "must be at most 32 base64url characters"}
+	}
+	return nil
+}
+
+// ttl returns the TTL to request, truncated to whole seconds, applying the
+// default and MaxTTL.
+func (o *Options) ttl() time.Duration {
+	switch {
+	case o.TTL == ZeroTTL:
+		return 0
+	case o.TTL == 0 || o.TTL > MaxTTL:
+		return MaxTTL
+	}
+	return o.TTL.Truncate(time.Second)
 }
 
 // Signer provides VAPID signing functionality.
@@ -52,182 +172,221 @@ type Signer interface {
 	PublicKey() []byte
 }
 
-// Client sends web push notifications.
+// Client sends web push notifications. It is configured by the options
+// passed to NewClient and can't be changed afterwards, so it is safe for
+// concurrent use.
 type Client struct {
-	signer     Signer
-	httpClient *http.Client
-	subject    string // VAPID subject (mailto: or https: URL)
+	signer          Signer
+	httpClient      *http.Client
+	subject         string // VAPID subject (mailto: or https: URL)
+	retryPolicy     RetryPolicy
+	tokenCache      *tokenCache    // nil disables caching
+	vapidExpiration time.Duration  // Lifetime of signed VAPID JWTs
+	extraClaims     map[string]any // Additional VAPID JWT claims
+	vapidScheme     VAPIDScheme    // Authorization header format
+	now             func() time.Time
+	defaults        Options // Merged with the Options passed to each send
+	interceptors    []SendInterceptor
+	send            SendFunc // sendWithResult wrapped by the interceptors
+	stats           *connStats
 }
 
 // NewClient creates a new web push client.
-func NewClient(signer Signer, subject string) *Client {
-	return &Client{
-		signer:     signer,
-		httpClient: http.DefaultClient,
-		subject:    subject,
-	}
+//
+// The subject identifies the sender to push services and must be a mailto:
+// or https: URI. Signed VAPID tokens are cached per push service by default;
+// see WithTokenCache. Requests use a transport built from
+// DefaultTransportOptions; see WithTransport.
+func NewClient(signer Signer, subject string, opts ...ClientOption) (*Client, error) {
+	if err := vapid.ValidateSubject(subject); err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		signer:          signer,
+		httpClient:      &http.Client{Transport: NewTransport(DefaultTransportOptions())},
+		subject:         subject,
+		tokenCache:      newTokenCache(DefaultTokenCacheOptions()),
+		vapidExpiration: defaultVAPIDExpiration,
+		now:             time.Now,
+		stats:           &connStats{},
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	c.send = chain(c.interceptors, c.sendWithResult)
+	return c, nil
 }
 
-// WithHTTPClient sets a custom HTTP client.
-func (c *Client) WithHTTPClient(httpClient *http.Client) *Client {
-	c.httpClient = httpClient
-	return c
+// SendResult describes a push message accepted by the push service.
+type SendResult struct {
+	StatusCode int           // HTTP status code returned by the push service; 202 if a receipt was requested
+	MessageURL string        // Push message resource from the Location header, if any; see Client.Cancel
+	MessageID  string        // Last path segment of MessageURL
+	TTL        time.Duration // TTL accepted by the push service
+	Latency    time.Duration // Time from sending the request to receiving the response
+	Attempts   int           // Number of delivery attempts made, including retries
 }
 
 // Send sends a web push notification to the given subscription.
 func (c *Client) Send(ctx context.Context, sub *Subscription, payload []byte, opts *Options) error {
+	_, err := c.SendWithResult(ctx, sub, payload, opts)
+	return err
+}
+
+// SendWithResult sends a web push notification to the given subscription and
+// returns details of the push message created by the push service. Invalid
+// options are reported as a *ValidationError before any request is made.
+// Sends pass through the Client's interceptors; see WithInterceptors.
+func (c *Client) SendWithResult(ctx context.Context, sub *Subscription, payload []byte, opts *Options) (*SendResult, error) {
+	// Merge into a copy so defaults don't leak into the caller's struct,
+	// which may be shared between concurrent sends, and interceptors can
+	// modify it freely.
+	o := c.defaults.merge(opts)
+	o.Header = o.Header.Clone()
+	return c.send(ctx, sub, payload, &o)
+}
+
+// sendWithResult sends a push message with options already merged with the
+// Client's defaults.
+func (c *Client) sendWithResult(ctx context.Context, sub *Subscription, payload []byte, opts *Options) (*SendResult, error) {
 	if opts == nil {
-		opts = &Options{}
+		opts = &Options{} // An interceptor passed nil
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
 	}
-	if opts.TTL == 0 {
-		opts.TTL = 2419200 // 4 weeks default
+	if p := lookupProfile(sub.Endpoint); p != nil && p.ValidateSubject != nil {
+		if err := p.ValidateSubject(c.subject); err != nil {
+			return nil, &ValidationError{Field: "subject", Value: c.subject, Reason: err.Error()}
+		}
 	}
+	ttl := opts.ttl()
 
 	// Encrypt the payload
-	encrypted, err := encrypt(sub, payload)
+	encrypted, err := Encrypt(sub, payload, &EncryptOptions{ContentEncoding: opts.ContentEncoding, Padding: opts.Padding})
 	if err != nil {
-		return fmt.Errorf("encrypting payload: %w", err)
+		return nil, fmt.Errorf("encrypting payload: %w", err)
 	}
 
-	// Create the VAPID header
-	vapidHeader, err := c.createVAPIDHeader(ctx, sub.Endpoint)
-	if err != nil {
-		return fmt.Errorf("creating VAPID header: %w", err)
-	}
+	header := make(http.Header)
+	encrypted.SetHeaders(header)
 
-	// Create and send the request
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(encrypted.ciphertext))
-	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
+	// Add the VAPID headers
+	if err := c.setVAPIDHeaders(ctx, header, sub.Endpoint, encrypted.Encoding); err != nil {
+		return nil, fmt.Errorf("creating VAPID header: %w", err)
 	}
-
-	req.Header.Set("Authorization", vapidHeader)
-	req.Header.Set("Content-Encoding", "aes128gcm")
-	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("TTL", strconv.Itoa(opts.TTL))
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("TTL", strconv.Itoa(int(ttl/time.Second)))
 
 	if opts.Urgency != "" {
-		req.Header.Set("Urgency", opts.Urgency)
+		header.Set("Urgency", string(opts.Urgency))
 	}
 	if opts.Topic != "" {
-		req.Header.Set("Topic", opts.Topic)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("sending request: %w", err)
+		header.Set("Topic", opts.Topic)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("push service returned %d: %s", resp.StatusCode, string(body))
+	if opts.ReceiptSubscription != "" {
+		header.Set("Push-Receipt", opts.ReceiptSubscription)
+		header.Set("Prefer", "respond-async")
 	}
-
-	return nil
-}
-
-type encryptedPayload struct {
-	ciphertext []byte
-}
-
-// encrypt encrypts the payload using RFC 8291 message encryption.
-func encrypt(sub *Subscription, plaintext []byte) (*encryptedPayload, error) {
-	// Decode subscription keys
-	p256dhBytes, err := base64.RawURLEncoding.DecodeString(sub.Keys.P256dh)
-	if err != nil {
-		return nil, fmt.Errorf("decoding p256dh: %w", err)
+	for k, v := range opts.Header {
+		if k = http.CanonicalHeaderKey(k); header.Get(k) == "" {
+			header[k] = v
+		}
 	}
 
-	authBytes, err := base64.RawURLEncoding.DecodeString(sub.Keys.Auth)
-	if err != nil {
-		return nil, fmt.Errorf("decoding auth: %w", err)
-	}
+	for attempt := 1; ; attempt++ {
+		result, err := c.post(ctx, sub.Endpoint, header, encrypted.Body, ttl)
+		if err == nil {
+			result.Attempts = attempt
+			return result, nil
+		}
 
-	// Parse client's public key
-	clientPubKey, err := ecdh.P256().NewPublicKey(p256dhBytes)
-	if err != nil {
-		return nil, fmt.Errorf("parsing client public key: %w", err)
+		delay, retry := c.retryPolicy.next(ctx, attempt, err)
+		if !retry {
+			return nil, err
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return nil, fmt.Errorf("waiting to retry: %w", err)
+		}
 	}
+}
 
-	// Generate ephemeral key pair for encryption
-	serverPrivKey, err := ecdh.P256().GenerateKey(rand.Reader)
+// post makes a single delivery attempt of an encrypted push message.
+func (c *Client) post(ctx context.Context, endpoint string, header http.Header, body []byte, ttl time.Duration) (*SendResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("generating server key: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
-	serverPubKey := serverPrivKey.PublicKey()
+	req.Header = header.Clone()
 
-	// Perform ECDH to get shared secret
-	sharedSecret, err := serverPrivKey.ECDH(clientPubKey)
+	start := time.Now()
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("computing shared secret: %w", err)
+		return nil, fmt.Errorf("sending request: %w", err)
 	}
+	defer resp.Body.Close()
+	latency := time.Since(start)
 
-	// Generate salt
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
-		return nil, fmt.Errorf("generating salt: %w", err)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newPushError(resp, respBody, endpoint)
 	}
 
-	// Derive keys using HKDF per RFC 8291
-	prkInfo := append([]byte("WebPush: info\x00"), clientPubKey.Bytes()...)
-	prkInfo = append(prkInfo, serverPubKey.Bytes()...)
+	return newSendResult(resp, ttl, latency), nil
+}
 
-	// IKM = HKDF-Extract(auth_secret, ecdh_secret)
-	prkHKDF := hkdf.New(sha256.New, sharedSecret, authBytes, prkInfo)
-	prk := make([]byte, 32)
-	if _, err := io.ReadFull(prkHKDF, prk); err != nil {
-		return nil, fmt.Errorf("deriving PRK: %w", err)
+// newSendResult builds a SendResult from a successful push service response.
+// The push service echoes the TTL it accepted, which may be lower than the
+// requested TTL; if it doesn't, the requested TTL is assumed.
+func newSendResult(resp *http.Response, requestedTTL time.Duration, latency time.Duration) *SendResult {
+	result := &SendResult{
+		StatusCode: resp.StatusCode,
+		TTL:        requestedTTL,
+		Latency:    latency,
 	}
-
-	// Derive content encryption key
-	cekInfo := []byte("Content-Encoding: aes128gcm\x00")
-	cekHKDF := hkdf.New(sha256.New, prk, salt, cekInfo)
-	cek := make([]byte, 16)
-	if _, err := io.ReadFull(cekHKDF, cek); err != nil {
-		return nil, fmt.Errorf("deriving CEK: %w", err)
+	if ttl, err := strconv.Atoi(resp.Header.Get("TTL")); err == nil && ttl >= 0 {
+		result.TTL = time.Duration(ttl) * time.Second
 	}
-
-	// Derive nonce
-	nonceInfo := []byte("Content-Encoding: nonce\x00")
-	nonceHKDF := hkdf.New(sha256.New, prk, salt, nonceInfo)
-	nonce := make([]byte, 12)
-	if _, err := io.ReadFull(nonceHKDF, nonce); err != nil {
-		return nil, fmt.Errorf("deriving nonce: %w", err)
-	}
-
-	// Encrypt using AES-128-GCM
-	block, err := aes.NewCipher(cek)
-	if err != nil {
-		return nil, fmt.Errorf("creating cipher: %w", err)
+	if loc, err := resp.Location(); err == nil {
+		result.MessageURL = loc.String()
+		result.MessageID = messageID(loc)
 	}
+	return result
+}
 
-	gcm, err := cipher.NewGCM(block)
+// setVAPIDHeaders sets the VAPID authentication headers for a message sent
+// to endpoint with the given content encoding, using the Client's VAPID
+// scheme. The legacy scheme appends the public key to any Crypto-Key header
+// already set.
+func (c *Client) setVAPIDHeaders(ctx context.Context, h http.Header, endpoint string, encoding ContentEncoding) error {
+	jwt, err := c.vapidToken(ctx, endpoint)
 	if err != nil {
-		return nil, fmt.Errorf("creating GCM: %w", err)
+		return err
 	}
 
-	// Add padding delimiter (0x02 for last record)
-	padded := append(plaintext, 0x02)
-
-	ciphertext := gcm.Seal(nil, nonce, padded, nil)
+	// Get public key in URL-safe base64
+	pubKeyB64 := base64.RawURLEncoding.EncodeToString(c.signer.PublicKey())
 
-	// Build the aes128gcm payload header
-	// Format: salt (16) || rs (4) || idlen (1) || keyid (65 for P-256 uncompressed)
-	recordSize := uint32(len(ciphertext) + 86) // header + ciphertext
-	header := make([]byte, 0, 86)
-	header = append(header, salt...)
-	header = binary.BigEndian.AppendUint32(header, recordSize)
-	header = append(header, byte(len(serverPubKey.Bytes())))
-	header = append(header, serverPubKey.Bytes()...)
+	if c.vapidScheme.resolve(encoding) == VAPIDSchemeWebPush {
+		h.Set("Authorization", "WebPush "+jwt)
+		if ck := h.Get("Crypto-Key"); ck != "" {
+			h.Set("Crypto-Key", ck+";p256ecdsa="+pubKeyB64)
+		} else {
+			h.Set("Crypto-Key", "p256ecdsa="+pubKeyB64)
+		}
+		return nil
+	}
 
-	return &encryptedPayload{
-		ciphertext: append(header, ciphertext...),
-	}, nil
+	h.Set("Authorization", "vapid t="+jwt+", k="+pubKeyB64)
+	return nil
 }
 
-// createVAPIDHeader creates the VAPID Authorization header.
-func (c *Client) createVAPIDHeader(ctx context.Context, endpoint string) (string, error) {
+// vapidToken returns a signed VAPID JWT for the origin of endpoint, from the
+// token cache if enabled.
+func (c *Client) vapidToken(ctx context.Context, endpoint string) (string, error) {
 	// Parse the endpoint to get the origin for the audience
 	parsedURL, err := url.Parse(endpoint)
 	if err != nil {
@@ -235,26 +394,40 @@ func (c *Client) createVAPIDHeader(ctx context.Context, endpoint string) (string
 	}
 	audience := parsedURL.Scheme + "://" + parsedURL.Host
 
+	if c.tokenCache != nil {
+		return c.tokenCache.get(ctx, audience, c.now(), c.signJWT)
+	}
+	jwt, _, err := c.signJWT(ctx, audience)
+	return jwt, err
+}
+
+// signJWT creates and signs a VAPID JWT for the given audience, returning the
+// token and its expiration time.
+func (c *Client) signJWT(ctx context.Context, audience string) (string, time.Time, error) {
+	expires := c.now().Add(c.vapidExpiration)
+
 	// Create JWT header and claims
 	header := map[string]string{
 		"typ": "JWT",
 		"alg": "ES256",
 	}
 
-	claims := map[string]interface{}{
-		"aud": audience,
-		"exp": time.Now().Add(12 * time.Hour).Unix(),
-		"sub": c.subject,
+	claims := make(map[string]any, len(c.extraClaims)+3)
+	for k, v := range c.extraClaims {
+		claims[k] = v
 	}
+	claims["aud"] = audience
+	claims["exp"] = expires.Unix()
+	claims["sub"] = c.subject
 
 	headerJSON, err := json.Marshal(header)
 	if err != nil {
-		return "", fmt.Errorf("marshaling header: %w", err)
+		return "", time.Time{}, fmt.Errorf("marshaling header: %w", err)
 	}
 
 	claimsJSON, err := json.Marshal(claims)
 	if err != nil {
-		return "", fmt.Errorf("marshaling claims: %w", err)
+		return "", time.Time{}, fmt.Errorf("marshaling claims: %w", err)
 	}
 
 	// Build the signing input
@@ -267,36 +440,9 @@ func (c *Client) createVAPIDHeader(ctx context.Context, endpoint string) (string
 	// Sign with ECDSA
 	signature, err := c.signer.Sign(ctx, hash[:])
 	if err != nil {
-		return "", fmt.Errorf("signing JWT: %w", err)
+		return "", time.Time{}, fmt.Errorf("signing JWT: %w", err)
 	}
 
 	// Build the JWT
-	jwt := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
-
-	// Get public key in URL-safe base64
-	pubKeyB64 := base64.RawURLEncoding.EncodeToString(c.signer.PublicKey())
-
-	return "vapid t=" + jwt + ", k=" + pubKeyB64, nil
-}
-
-// ParseSubscription parses a subscription from JSON.
-func ParseSubscription(data []byte) (*Subscription, error) {
-	var sub Subscription
-	if err := json.Unmarshal(data, &sub); err != nil {
-		return nil, fmt.Errorf("unmarshaling subscription: %w", err)
-	}
-	if sub.Endpoint == "" {
-		return nil, errors.New("subscription endpoint is required")
-	}
-	if sub.Keys.P256dh == "" {
-		return nil, errors.New("subscription p256dh key is required")
-	}
-	if sub.Keys.Auth == "" {
-		return nil, errors.New("subscription auth key is required")
-	}
-	// Validate endpoint is HTTPS
-	if !strings.HasPrefix(sub.Endpoint, "https://") {
-		return nil, errors.New("subscription endpoint must use HTTPS")
-	}
-	return &sub, nil
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), expires, nil
 }